@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/dilshat/sms-sender/smscsim"
+	"github.com/dilshat/sms-sender/util"
+	"go.uber.org/zap"
+)
+
+// SMPP 3.4 SMSC simulator for local development, configured with environment variables:
+//
+//	SIM_ADDR              listen address, default :2775
+//	SIM_ID, SIM_PWD       accepted credentials, empty accepts any
+//	SIM_SUBMIT_STATUS     command status of submit_sm_resp, default 0
+//	SIM_LATENCY_MS        delay before submit_sm_resp
+//	SIM_RECEIPT_DELAY_MS  delay before delivery receipt
+//	SIM_RECEIPT_STAT      status reported in delivery receipts, default DELIVRD, empty disables receipts
+func main() {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatal("Error initializing logger", err)
+	}
+	zap.ReplaceGlobals(logger)
+	defer zap.L().Sync()
+
+	sim := smscsim.New(smscsim.Config{
+		SystemId:     util.GetEnv("SIM_ID", ""),
+		Password:     util.GetEnv("SIM_PWD", ""),
+		SubmitStatus: uint32(util.GetEnvAsInt("SIM_SUBMIT_STATUS", 0)),
+		Latency:      time.Duration(util.GetEnvAsInt("SIM_LATENCY_MS", 0)) * time.Millisecond,
+		ReceiptDelay: time.Duration(util.GetEnvAsInt("SIM_RECEIPT_DELAY_MS", 500)) * time.Millisecond,
+		ReceiptStat:  util.GetEnv("SIM_RECEIPT_STAT", "DELIVRD"),
+	})
+
+	err = sim.Listen(util.GetEnv("SIM_ADDR", ":2775"))
+	if err != nil {
+		zap.L().Fatal("Error starting simulator", zap.Error(err))
+	}
+	zap.L().Info("SMSC simulator started", zap.String("addr", sim.Addr().String()))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+
+	_ = sim.Close()
+}
@@ -49,6 +49,7 @@ func GetSendSmsFunc(srv service.Service) echo.HandlerFunc {
 // @Produce json
 // @Param id path int true "Message id"
 // @Param phone query string false "Phone number"
+// @Param history query bool false "Return status history and latencies of every phone"
 // @Success 200 {object} dto.MessageStatus
 // @Failure 400 "error description"
 // @Router /sms/{id} [get]
@@ -63,8 +64,16 @@ func GetCheckSmsFunc(service service.Service) echo.HandlerFunc {
 		}
 		id32 := uint32(id64)
 
+		history := false
+		if h := c.QueryParam("history"); strings.TrimSpace(h) != "" {
+			history, err = strconv.ParseBool(h)
+			if err != nil {
+				return c.String(http.StatusBadRequest, "Invalid history "+h)
+			}
+		}
+
 		if strings.TrimSpace(phone) == "" {
-			status, err := service.CheckStatusOfMessage(id32)
+			status, err := service.CheckStatusOfMessage(id32, history)
 			if err != nil {
 				if err.Error() == "not found" {
 					return c.String(http.StatusNotFound, "Message not found "+id)
@@ -76,7 +85,7 @@ func GetCheckSmsFunc(service service.Service) echo.HandlerFunc {
 
 			return c.JSON(http.StatusOK, status)
 		} else {
-			status, err := service.CheckStatusOfRecipient(id32, phone)
+			status, err := service.CheckStatusOfRecipient(id32, phone, history)
 			if err != nil {
 				if err.Error() == "not found" {
 					return c.String(http.StatusNotFound, "Phone not found "+phone)
@@ -91,3 +100,118 @@ func GetCheckSmsFunc(service service.Service) echo.HandlerFunc {
 
 	}
 }
+
+// CancelSms godoc
+// @Summary Cancel sms
+// @Description Cancels sms message not delivered yet: removes it from the schedule or the outgoing queue,
+// @Description submitted messages are cancelled at SMSC
+// @Produce json
+// @Param id path int true "Message id"
+// @Param phone query string false "Phone number"
+// @Success 200 {object} dto.OperationResult
+// @Failure 404 "error description"
+// @Router /sms/{id} [delete]
+func GetCancelSmsFunc(srv service.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		phone := c.QueryParam("phone")
+
+		id64, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return err
+		}
+
+		result, err := srv.CancelMessage(uint32(id64), strings.TrimSpace(phone))
+		if err != nil {
+			if err.Error() == "not found" {
+				return c.String(http.StatusNotFound, "Message not found "+id)
+			}
+			zap.L().Error("Error cancelling message", zap.Error(err))
+			return c.String(http.StatusInternalServerError, "System malfunction. Please, try later")
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// ReplaceSms godoc
+// @Summary Replace sms
+// @Description Replaces text of sms message not delivered yet, submitted messages are replaced at SMSC
+// @Accept json
+// @Produce json
+// @Param id path int true "Message id"
+// @Param phone query string false "Phone number"
+// @Param text body dto.Replacement true "New text"
+// @Success 200 {object} dto.OperationResult
+// @Failure 400 "error description"
+// @Failure 404 "error description"
+// @Router /sms/{id} [patch]
+func GetReplaceSmsFunc(srv service.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		phone := c.QueryParam("phone")
+
+		id64, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return err
+		}
+
+		replacement := new(dto.Replacement)
+		if err := c.Bind(replacement); err != nil {
+			return err
+		}
+
+		result, err := srv.ReplaceMessage(uint32(id64), strings.TrimSpace(phone), replacement.Text)
+		if err != nil {
+			switch err.(type) {
+			case *service.InvalidPayloadErr:
+				return c.String(http.StatusBadRequest, err.Error())
+			default:
+				if err.Error() == "not found" {
+					return c.String(http.StatusNotFound, "Message not found "+id)
+				}
+				zap.L().Error("Error replacing message", zap.Error(err))
+				return c.String(http.StatusInternalServerError, "System malfunction. Please, try later")
+			}
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetInbound godoc
+// @Summary Get inbound sms
+// @Description Returns latest messages received from subscribers, newest first
+// @Produce json
+// @Param phone query string false "Phone number"
+// @Param limit query int false "Max number of messages, 100 by default"
+// @Success 200 {array} dto.InboundMessage
+// @Failure 400 "error description"
+// @Router /inbound [get]
+func GetInboundFunc(srv service.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		phone := c.QueryParam("phone")
+		limit := 100
+
+		if l := c.QueryParam("limit"); strings.TrimSpace(l) != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil {
+				return c.String(http.StatusBadRequest, "Invalid limit "+l)
+			}
+		}
+
+		messages, err := srv.GetInbound(phone, limit)
+		if err != nil {
+			switch err.(type) {
+			case *service.InvalidPayloadErr:
+				return c.String(http.StatusBadRequest, err.Error())
+			default:
+				zap.L().Error("Error reading inbound messages", zap.Error(err))
+				return c.String(http.StatusInternalServerError, "System malfunction. Please, try later")
+			}
+		}
+
+		return c.JSON(http.StatusOK, messages)
+	}
+}
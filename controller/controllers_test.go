@@ -79,49 +79,176 @@ func TestGetCheckSmsFunc(t *testing.T) {
 	stringCalled = false
 	f = GetCheckSmsFunc(mockService{checkStatusErr: errors.New("not found")})
 
-	_ = f(mockContext{param: "123", queryParam: "996YYYAABBCC"})
+	_ = f(mockContext{param: "123", queryParams: map[string]string{"phone": "996YYYAABBCC"}})
 
 	require.True(t, stringCalled)
 
 	stringCalled = false
 	f = GetCheckSmsFunc(mockService{checkStatusErr: errors.New("blablabla")})
 
-	_ = f(mockContext{param: "123", queryParam: "996YYYAABBCC"})
+	_ = f(mockContext{param: "123", queryParams: map[string]string{"phone": "996YYYAABBCC"}})
 
 	require.True(t, stringCalled)
 
 	OK200 = false
 	f = GetCheckSmsFunc(mockService{})
 
-	_ = f(mockContext{param: "123", queryParam: "996YYYAABBCC"})
+	_ = f(mockContext{param: "123", queryParams: map[string]string{"phone": "996YYYAABBCC"}})
 
 	require.True(t, OK200)
+
+	OK200 = false
+
+	_ = f(mockContext{param: "123", queryParams: map[string]string{"history": "true"}})
+
+	require.True(t, OK200)
+
+	stringCalled = false
+
+	_ = f(mockContext{param: "123", queryParams: map[string]string{"history": "yes please"}})
+
+	require.True(t, stringCalled)
+}
+
+func TestGetCancelSmsFunc(t *testing.T) {
+	OK200 = false
+	f := GetCancelSmsFunc(mockService{})
+
+	err := f(mockContext{param: "123"})
+
+	require.NoError(t, err)
+	require.True(t, OK200)
+
+	err = f(mockContext{param: ""})
+
+	require.Error(t, err)
+
+	OK200 = false
+
+	err = f(mockContext{param: "123", queryParams: map[string]string{"phone": "996YYYAABBCC"}})
+
+	require.NoError(t, err)
+	require.True(t, OK200)
+
+	stringCalled = false
+	f = GetCancelSmsFunc(mockService{cancelErr: errors.New("not found")})
+
+	_ = f(mockContext{param: "123"})
+
+	require.True(t, stringCalled)
+
+	stringCalled = false
+	f = GetCancelSmsFunc(mockService{cancelErr: errors.New("blablabla")})
+
+	_ = f(mockContext{param: "123"})
+
+	require.True(t, stringCalled)
+}
+
+func TestGetReplaceSmsFunc(t *testing.T) {
+	OK200 = false
+	f := GetReplaceSmsFunc(mockService{})
+
+	err := f(mockContext{param: "123"})
+
+	require.NoError(t, err)
+	require.True(t, OK200)
+
+	err = f(mockContext{param: ""})
+
+	require.Error(t, err)
+
+	bindError := errors.New("Bind error")
+
+	err = f(mockContext{param: "123", bindError: bindError})
+
+	require.Equal(t, bindError, err)
+
+	stringCalled = false
+	f = GetReplaceSmsFunc(mockService{replaceErr: service.NewInvalidPayloadError("blablabla")})
+
+	_ = f(mockContext{param: "123"})
+
+	require.True(t, stringCalled)
+
+	stringCalled = false
+	f = GetReplaceSmsFunc(mockService{replaceErr: errors.New("not found")})
+
+	_ = f(mockContext{param: "123"})
+
+	require.True(t, stringCalled)
+}
+
+func TestGetInboundFunc(t *testing.T) {
+	OK200 = false
+	f := GetInboundFunc(mockService{})
+
+	err := f(mockContext{})
+
+	require.NoError(t, err)
+	require.True(t, OK200)
+
+	stringCalled = false
+
+	_ = f(mockContext{queryParams: map[string]string{"limit": "abc"}})
+
+	require.True(t, stringCalled)
+
+	stringCalled = false
+	f = GetInboundFunc(mockService{inboundErr: service.NewInvalidPayloadError("blablabla")})
+
+	_ = f(mockContext{queryParams: map[string]string{"limit": "-1"}})
+
+	require.True(t, stringCalled)
+
+	stringCalled = false
+	f = GetInboundFunc(mockService{inboundErr: errors.New("blablabla")})
+
+	_ = f(mockContext{})
+
+	require.True(t, stringCalled)
 }
 
 //-----------mocks--------
 type mockContext struct {
-	bindError  error
-	param      string
-	queryParam string
+	bindError   error
+	param       string
+	queryParam  string
+	queryParams map[string]string
 }
 
 type mockService struct {
 	sendMsgErr     error
 	checkStatusErr error
+	inboundErr     error
+	cancelErr      error
+	replaceErr     error
 }
 
 func (m mockService) SendMessage(message dto.Message) (dto.Id, error) {
 	return dto.Id{}, m.sendMsgErr
 }
 
-func (m mockService) CheckStatusOfMessage(id uint32) (dto.MessageStatus, error) {
+func (m mockService) CheckStatusOfMessage(id uint32, history bool) (dto.MessageStatus, error) {
 	return dto.MessageStatus{}, m.checkStatusErr
 }
 
-func (m mockService) CheckStatusOfRecipient(id uint32, phone string) (dto.MessageStatus, error) {
+func (m mockService) CheckStatusOfRecipient(id uint32, phone string, history bool) (dto.MessageStatus, error) {
 	return dto.MessageStatus{}, m.checkStatusErr
 }
 
+func (m mockService) CancelMessage(id uint32, phone string) (dto.OperationResult, error) {
+	return dto.OperationResult{}, m.cancelErr
+}
+
+func (m mockService) ReplaceMessage(id uint32, phone, text string) (dto.OperationResult, error) {
+	return dto.OperationResult{}, m.replaceErr
+}
+
+func (m mockService) GetInbound(phone string, limit int) ([]dto.InboundMessage, error) {
+	return []dto.InboundMessage{}, m.inboundErr
+}
+
 func (m mockContext) Request() *http.Request {
 	panic("implement me")
 }
@@ -185,6 +312,9 @@ func (m mockContext) SetParamValues(values ...string) {
 }
 
 func (m mockContext) QueryParam(name string) string {
+	if m.queryParams != nil {
+		return m.queryParams[name]
+	}
 	return m.queryParam
 }
 
@@ -46,6 +46,30 @@ func GetClient(dbFilePath string) (Db, error) {
 			if err != nil {
 				return
 			}
+			err = instance.Init(&model.Outgoing{})
+			if err != nil {
+				return
+			}
+			err = instance.Init(&model.Segment{})
+			if err != nil {
+				return
+			}
+			err = instance.Init(&model.Inbound{})
+			if err != nil {
+				return
+			}
+			err = instance.Init(&model.PendingReceipt{})
+			if err != nil {
+				return
+			}
+			err = instance.Init(&model.StatusEvent{})
+			if err != nil {
+				return
+			}
+			err = instance.Init(&model.Schedule{})
+			if err != nil {
+				return
+			}
 		} else {
 			instance, err = storm.Open(dbFilePath, storm.BoltOptions(0600, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: false}))
 			if err != nil {
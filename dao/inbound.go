@@ -0,0 +1,58 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/dilshat/sms-sender/model"
+)
+
+type InboundDao interface {
+	//Create creates inbound message record and returns its id
+	Create(source, destination, text, route string, partial bool) (uint32, error)
+	//GetOneById returns inbound message by id
+	GetOneById(id uint32) (model.Inbound, error)
+	//GetLast returns at most {limit} latest inbound messages, newest first; empty source returns messages from all phones
+	GetLast(source string, limit int) ([]model.Inbound, error)
+	//RemoveOlderThanDays removes all inbound messages older than {days}
+	RemoveOlderThanDays(days int) error
+}
+
+func NewInboundDao(db Db) InboundDao {
+	return &inboundDao{db: db}
+}
+
+type inboundDao struct {
+	db Db
+}
+
+func (i inboundDao) RemoveOlderThanDays(days int) error {
+	err := i.db.Select(q.Lt("CreatedAt", time.Now().Add(-24*time.Duration(days)*time.Hour))).Delete(&model.Inbound{})
+	if err != nil && err.Error() != "not found" {
+		return err
+	}
+	return nil
+}
+
+func (i inboundDao) Create(source, destination, text, route string, partial bool) (uint32, error) {
+	inbound := &model.Inbound{Source: source, Destination: destination, Text: text, Route: route, Partial: partial, CreatedAt: time.Now()}
+	err := i.db.Save(inbound)
+	return inbound.Id, err
+}
+
+func (i inboundDao) GetOneById(id uint32) (inbound model.Inbound, err error) {
+	err = i.db.One("Id", id, &inbound)
+	return
+}
+
+func (i inboundDao) GetLast(source string, limit int) (messages []model.Inbound, err error) {
+	var matchers []q.Matcher
+	if source != "" {
+		matchers = append(matchers, q.Eq("Source", source))
+	}
+	err = i.db.Select(matchers...).OrderBy("Id").Reverse().Limit(limit).Find(&messages)
+	if err != nil && err.Error() == "not found" {
+		return []model.Inbound{}, nil
+	}
+	return
+}
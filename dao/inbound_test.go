@@ -0,0 +1,69 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInboundDao_Create(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	inDao := NewInboundDao(db)
+
+	id, err := inDao.Create(PHONE1, SENDER, TEXT, ROUTE, true)
+
+	require.NoError(t, err)
+	require.True(t, id > 0)
+
+	one, err := inDao.GetOneById(id)
+
+	require.NoError(t, err)
+	require.Equal(t, PHONE1, one.Source)
+	require.Equal(t, TEXT, one.Text)
+	require.Equal(t, ROUTE, one.Route)
+	require.True(t, one.Partial)
+}
+
+func TestInboundDao_GetLast(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	inDao := NewInboundDao(db)
+
+	all, err := inDao.GetLast("", 10)
+
+	require.NoError(t, err)
+	require.Equal(t, 0, len(all))
+
+	_, _ = inDao.Create(PHONE1, SENDER, TEXT, ROUTE, false)
+	_, _ = inDao.Create(PHONE2, SENDER, TEXT, ROUTE, false)
+	_, _ = inDao.Create(PHONE1, SENDER, TEXT2, ROUTE, false)
+
+	all, err = inDao.GetLast("", 2)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, len(all))
+	//newest first
+	require.Equal(t, TEXT2, all[0].Text)
+
+	all, err = inDao.GetLast(PHONE1, 10)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, len(all))
+	require.Equal(t, PHONE1, all[1].Source)
+}
+
+func TestInboundDao_RemoveOlderThanDays(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	inDao := NewInboundDao(db)
+	_, _ = inDao.Create(PHONE1, SENDER, TEXT, ROUTE, false)
+
+	err := inDao.RemoveOlderThanDays(1)
+
+	require.NoError(t, err)
+
+	all, _ := inDao.GetLast("", 10)
+
+	require.Equal(t, 1, len(all))
+}
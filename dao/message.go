@@ -7,10 +7,12 @@ import (
 )
 
 type MessageDao interface {
-	//Create creates message record and returns its id
-	Create(text, sender string) (uint32, error)
+	//Create creates message record with submit options and returns its id
+	Create(text, sender string, options model.SubmitOptions) (uint32, error)
 	//GetOneById returns message by id
 	GetOneById(id uint32) (model.Message, error)
+	//UpdateText replaces text of the message
+	UpdateText(id uint32, text string) error
 	//GetAll returns all messages
 	GetAll() ([]model.Message, error)
 	//RemoveOlderThanDays removes all messages older than {days}
@@ -43,8 +45,18 @@ func (d messageDao) GetAll() (messages []model.Message, err error) {
 	return
 }
 
-func (d messageDao) Create(text, sender string) (uint32, error) {
-	msg := &model.Message{Sender: sender, Text: text, CreatedAt: time.Now()}
+func (d messageDao) Create(text, sender string, options model.SubmitOptions) (uint32, error) {
+	msg := &model.Message{Sender: sender, Text: text, Options: options, CreatedAt: time.Now()}
 	err := d.db.Save(msg)
 	return msg.Id, err
 }
+
+func (d messageDao) UpdateText(id uint32, text string) error {
+	var msg model.Message
+	err := d.db.One("Id", id, &msg)
+	if err != nil {
+		return err
+	}
+	msg.Text = text
+	return d.db.Update(&msg)
+}
@@ -50,10 +50,14 @@ func TestMessageDao_Create(t *testing.T) {
 	defer cleanup()
 	msgDao := NewMessageDao(db)
 
-	id, err := msgDao.Create(TEXT, SENDER)
+	id, err := msgDao.Create(TEXT, SENDER, model.SubmitOptions{Priority: 1})
 
 	require.NoError(t, err)
 	require.True(t, id > 0)
+
+	msg, _ := msgDao.GetOneById(id)
+
+	require.Equal(t, 1, msg.Options.Priority)
 }
 
 func TestMessageDao_GetOneById(t *testing.T) {
@@ -68,6 +72,21 @@ func TestMessageDao_GetOneById(t *testing.T) {
 	require.Equal(t, ID1, msg.Id)
 }
 
+func TestMessageDao_UpdateText(t *testing.T) {
+	db, cleanup := prepareDB(t)
+	defer cleanup()
+	msgDao := NewMessageDao(db)
+
+	err := msgDao.UpdateText(ID1, TEXT2)
+
+	require.NoError(t, err)
+
+	msg, _ := msgDao.GetOneById(ID1)
+
+	require.Equal(t, TEXT2, msg.Text)
+	require.Equal(t, SENDER, msg.Sender)
+}
+
 func TestMessageDao_GetAll(t *testing.T) {
 	db, cleanup := prepareDB(t)
 	defer cleanup()
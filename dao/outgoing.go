@@ -0,0 +1,137 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/dilshat/sms-sender/model"
+)
+
+type OutgoingDao interface {
+	//Push appends message to the tail of the queue of the route and returns its id
+	Push(recipientId uint32, route, sender, phone, text string, options model.SubmitOptions) (uint32, error)
+	//GetFirst returns the oldest message in the queue of the route which is not in flight
+	GetFirst(route string) (model.Outgoing, error)
+	//SetInFlight marks the message with the given id as submitted or returns it to the queue
+	SetInFlight(id uint32, inFlight bool) error
+	//CompletePart counts final submit result of a part of the in-flight message of the recipient,
+	//the message is removed once results of all its partsCount parts are counted, true is returned then
+	CompletePart(recipientId uint32, partsCount int) (bool, error)
+	//RequeueInFlight returns all in-flight messages to the queue
+	RequeueInFlight() error
+	//IncAttempts increments the number of failed send attempts of the message with the given id
+	IncAttempts(id uint32) (int, error)
+	//Remove removes message with the given id from the queue
+	Remove(id uint32) error
+	//GetByRecipientId returns queued message of the recipient
+	GetByRecipientId(recipientId uint32) (model.Outgoing, error)
+	//UpdateText replaces text of the queued message with the given id
+	UpdateText(id uint32, text string) error
+}
+
+func NewOutgoingDao(db Db) OutgoingDao {
+	return &outgoingDao{db: db}
+}
+
+type outgoingDao struct {
+	db Db
+}
+
+func (o outgoingDao) Push(recipientId uint32, route, sender, phone, text string, options model.SubmitOptions) (uint32, error) {
+	outgoing := &model.Outgoing{RecipientId: recipientId, Route: route, Sender: sender, Phone: phone, Text: text, Options: options, CreatedAt: time.Now()}
+	err := o.db.Save(outgoing)
+	return outgoing.Id, err
+}
+
+func (o outgoingDao) GetFirst(route string) (model.Outgoing, error) {
+	//ids are stored in big endian so bucket order is the insertion order
+	var outgoings []model.Outgoing
+	err := o.db.Select(q.Eq("Route", route), q.Eq("InFlight", false)).Limit(1).Find(&outgoings)
+	var outgoing model.Outgoing
+	if err != nil {
+		return outgoing, err
+	}
+	if len(outgoings) > 0 {
+		outgoing = outgoings[0]
+	}
+
+	return outgoing, err
+}
+
+func (o outgoingDao) SetInFlight(id uint32, inFlight bool) error {
+	var outgoing model.Outgoing
+	err := o.db.One("Id", id, &outgoing)
+	if err != nil {
+		return err
+	}
+	outgoing.InFlight = inFlight
+	outgoing.Done = 0
+	//Save stores zero values unlike Update
+	return o.db.Save(&outgoing)
+}
+
+func (o outgoingDao) CompletePart(recipientId uint32, partsCount int) (bool, error) {
+	var outgoing model.Outgoing
+	err := o.db.One("RecipientId", recipientId, &outgoing)
+	if err != nil {
+		return false, err
+	}
+	if !outgoing.InFlight {
+		return false, nil
+	}
+
+	outgoing.Done++
+	if outgoing.Done >= partsCount {
+		return true, o.Remove(outgoing.Id)
+	}
+	return false, o.db.Update(&outgoing)
+}
+
+func (o outgoingDao) RequeueInFlight() error {
+	var outgoings []model.Outgoing
+	err := o.db.Select(q.Eq("InFlight", true)).Find(&outgoings)
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil
+		}
+		return err
+	}
+
+	for _, outgoing := range outgoings {
+		err = o.SetInFlight(outgoing.Id, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o outgoingDao) IncAttempts(id uint32) (int, error) {
+	var outgoing model.Outgoing
+	err := o.db.One("Id", id, &outgoing)
+	if err != nil {
+		return 0, err
+	}
+	outgoing.Attempts++
+	return outgoing.Attempts, o.db.Update(&outgoing)
+}
+
+func (o outgoingDao) Remove(id uint32) error {
+	return o.db.DeleteStruct(&model.Outgoing{Id: id})
+}
+
+func (o outgoingDao) GetByRecipientId(recipientId uint32) (model.Outgoing, error) {
+	var outgoing model.Outgoing
+	err := o.db.One("RecipientId", recipientId, &outgoing)
+	return outgoing, err
+}
+
+func (o outgoingDao) UpdateText(id uint32, text string) error {
+	var outgoing model.Outgoing
+	err := o.db.One("Id", id, &outgoing)
+	if err != nil {
+		return err
+	}
+	outgoing.Text = text
+	return o.db.Update(&outgoing)
+}
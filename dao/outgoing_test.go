@@ -0,0 +1,201 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ROUTE  = "default"
+	ROUTE2 = "backup"
+)
+
+func TestOutgoingDao_Push(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+
+	id, err := outDao.Push(ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+
+	require.NoError(t, err)
+	require.True(t, id > 0)
+}
+
+func TestOutgoingDao_GetFirst(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+
+	_, err := outDao.GetFirst(ROUTE)
+
+	require.Error(t, err)
+
+	id2, _ := outDao.Push(MSG_ID2, ROUTE2, SENDER2, PHONE2, TEXT2, model.SubmitOptions{})
+	id, _ := outDao.Push(MSG_ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{Priority: 2})
+	_, _ = outDao.Push(MSG_ID2, ROUTE, SENDER2, PHONE2, TEXT2, model.SubmitOptions{})
+
+	first, err := outDao.GetFirst(ROUTE)
+
+	require.NoError(t, err)
+	require.Equal(t, id, first.Id)
+	require.Equal(t, MSG_ID1, first.RecipientId)
+	require.Equal(t, PHONE1, first.Phone)
+	require.Equal(t, 2, first.Options.Priority)
+
+	first, _ = outDao.GetFirst(ROUTE2)
+
+	require.Equal(t, id2, first.Id)
+}
+
+func TestOutgoingDao_IncAttempts(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+	id, _ := outDao.Push(MSG_ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+
+	attempts, err := outDao.IncAttempts(id)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts)
+
+	attempts, _ = outDao.IncAttempts(id)
+
+	require.Equal(t, 2, attempts)
+}
+
+func TestOutgoingDao_Remove(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+	id, _ := outDao.Push(MSG_ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+	id2, _ := outDao.Push(MSG_ID2, ROUTE, SENDER2, PHONE2, TEXT2, model.SubmitOptions{})
+
+	err := outDao.Remove(id)
+
+	require.NoError(t, err)
+
+	first, _ := outDao.GetFirst(ROUTE)
+
+	require.Equal(t, id2, first.Id)
+}
+
+func TestOutgoingDao_GetByRecipientId(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+
+	_, err := outDao.GetByRecipientId(MSG_ID1)
+
+	require.Error(t, err)
+
+	_, _ = outDao.Push(MSG_ID2, ROUTE, SENDER2, PHONE2, TEXT2, model.SubmitOptions{})
+	id, _ := outDao.Push(MSG_ID1, ROUTE2, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+
+	outgoing, err := outDao.GetByRecipientId(MSG_ID1)
+
+	require.NoError(t, err)
+	require.Equal(t, id, outgoing.Id)
+	require.Equal(t, ROUTE2, outgoing.Route)
+}
+
+func TestOutgoingDao_UpdateText(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+	id, _ := outDao.Push(MSG_ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+
+	err := outDao.UpdateText(id, TEXT2)
+
+	require.NoError(t, err)
+
+	first, _ := outDao.GetFirst(ROUTE)
+
+	require.Equal(t, TEXT2, first.Text)
+
+	err = outDao.UpdateText(id+1, TEXT)
+
+	require.Error(t, err)
+}
+
+func TestOutgoingDao_SetInFlight(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+	id, _ := outDao.Push(MSG_ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+	id2, _ := outDao.Push(MSG_ID2, ROUTE, SENDER2, PHONE2, TEXT2, model.SubmitOptions{})
+
+	err := outDao.SetInFlight(id, true)
+
+	require.NoError(t, err)
+
+	//in-flight message is skipped
+	first, _ := outDao.GetFirst(ROUTE)
+
+	require.Equal(t, id2, first.Id)
+
+	err = outDao.SetInFlight(id, false)
+
+	require.NoError(t, err)
+
+	first, _ = outDao.GetFirst(ROUTE)
+
+	require.Equal(t, id, first.Id)
+	require.False(t, first.InFlight)
+
+	err = outDao.SetInFlight(id2+1, true)
+
+	require.Error(t, err)
+}
+
+func TestOutgoingDao_CompletePart(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+	id, _ := outDao.Push(MSG_ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+
+	//results are counted only while the message is in flight
+	removed, err := outDao.CompletePart(MSG_ID1, 2)
+
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	_ = outDao.SetInFlight(id, true)
+
+	removed, err = outDao.CompletePart(MSG_ID1, 2)
+
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	removed, err = outDao.CompletePart(MSG_ID1, 2)
+
+	require.NoError(t, err)
+	require.True(t, removed)
+
+	_, err = outDao.GetByRecipientId(MSG_ID1)
+
+	require.Error(t, err)
+}
+
+func TestOutgoingDao_RequeueInFlight(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	outDao := NewOutgoingDao(db)
+
+	err := outDao.RequeueInFlight()
+
+	require.NoError(t, err)
+
+	id, _ := outDao.Push(MSG_ID1, ROUTE, SENDER, PHONE1, TEXT, model.SubmitOptions{})
+	_ = outDao.SetInFlight(id, true)
+
+	err = outDao.RequeueInFlight()
+
+	require.NoError(t, err)
+
+	first, err := outDao.GetFirst(ROUTE)
+
+	require.NoError(t, err)
+	require.Equal(t, id, first.Id)
+}
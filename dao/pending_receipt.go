@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/dilshat/sms-sender/model"
+)
+
+type PendingReceiptDao interface {
+	//Create stores receipt with the delivery id not known yet
+	Create(deliverId, status, errorCode string, doneAt time.Time) error
+	//TakeByDeliverId removes and returns all receipts with the delivery id
+	TakeByDeliverId(deliverId string) ([]model.PendingReceipt, error)
+	//RemoveOlderThan removes all receipts stored longer than {age}
+	RemoveOlderThan(age time.Duration) error
+}
+
+func NewPendingReceiptDao(db Db) PendingReceiptDao {
+	return &pendingReceiptDao{db: db}
+}
+
+type pendingReceiptDao struct {
+	db Db
+}
+
+func (p pendingReceiptDao) Create(deliverId, status, errorCode string, doneAt time.Time) error {
+	receipt := &model.PendingReceipt{DeliverId: strings.ToUpper(deliverId), Status: status, ErrorCode: errorCode, DoneAt: doneAt, CreatedAt: time.Now()}
+	return p.db.Save(receipt)
+}
+
+func (p pendingReceiptDao) TakeByDeliverId(deliverId string) ([]model.PendingReceipt, error) {
+	var receipts []model.PendingReceipt
+	err := p.db.Find("DeliverId", strings.ToUpper(deliverId), &receipts)
+	if err != nil {
+		if err.Error() == "not found" {
+			return []model.PendingReceipt{}, nil
+		}
+		return nil, err
+	}
+
+	for i := range receipts {
+		err = p.db.DeleteStruct(&receipts[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return receipts, nil
+}
+
+func (p pendingReceiptDao) RemoveOlderThan(age time.Duration) error {
+	err := p.db.Select(q.Lt("CreatedAt", time.Now().Add(-age))).Delete(&model.PendingReceipt{})
+	if err != nil && err.Error() != "not found" {
+		return err
+	}
+	return nil
+}
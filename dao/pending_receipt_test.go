@@ -0,0 +1,61 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingReceiptDao_TakeByDeliverId(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	prDao := NewPendingReceiptDao(db)
+
+	receipts, err := prDao.TakeByDeliverId(DELIVER_ID2)
+
+	require.NoError(t, err)
+	require.Equal(t, 0, len(receipts))
+
+	err = prDao.Create("abcd", model.UNDELIV, ERROR_CODE, time.Now())
+
+	require.NoError(t, err)
+
+	receipts, err = prDao.TakeByDeliverId(DELIVER_ID2)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, len(receipts))
+	require.Equal(t, model.UNDELIV, receipts[0].Status)
+	require.Equal(t, ERROR_CODE, receipts[0].ErrorCode)
+
+	//taken receipts are removed
+	receipts, _ = prDao.TakeByDeliverId(DELIVER_ID2)
+
+	require.Equal(t, 0, len(receipts))
+}
+
+func TestPendingReceiptDao_RemoveOlderThan(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	prDao := NewPendingReceiptDao(db)
+	_ = prDao.Create(DELIVER_ID, model.DELIVRD, "", time.Time{})
+
+	err := prDao.RemoveOlderThan(time.Hour)
+
+	require.NoError(t, err)
+
+	receipts, _ := prDao.TakeByDeliverId(DELIVER_ID)
+
+	require.Equal(t, 1, len(receipts))
+
+	_ = prDao.Create(DELIVER_ID, model.DELIVRD, "", time.Time{})
+
+	err = prDao.RemoveOlderThan(0)
+
+	require.NoError(t, err)
+
+	receipts, _ = prDao.TakeByDeliverId(DELIVER_ID)
+
+	require.Equal(t, 0, len(receipts))
+}
@@ -9,16 +9,23 @@ import (
 )
 
 type RecipientDao interface {
-	//Create creates recipient record and returns its id
-	Create(messageId uint32, phone string) (uint32, error)
-	//UpdateSubmitStatus updates status and delivery id of recipient record with the given id
-	UpdateSubmitStatus(id uint32, deliverId string, status string) error
-	//UpdateDeliverStatus updates status of recipient record with the delivery id
-	UpdateDeliverStatus(deliverId string, status string) (uint32, string, error)
+	//Create creates recipient record with the initial status (NEW or SCHEDULED) and returns its id
+	Create(messageId uint32, phone, status string) (uint32, error)
+	//UpdateSubmitStatus updates status, delivery id and SMSC route of recipient record with the given id,
+	//status regressions are not applied and reported with model.IgnoredTransitionErr
+	UpdateSubmitStatus(id uint32, deliverId, status, route string) error
+	//UpdateDeliverStatus updates status, error code and done date of recipient record with the delivery id
+	UpdateDeliverStatus(deliverId, status, errorCode string, doneAt time.Time) (uint32, string, error)
+	//UpdateStatus updates status, error code and done date of recipient record with the given id and returns its message id and phone
+	UpdateStatus(id uint32, status, errorCode string, doneAt time.Time) (uint32, string, error)
+	//GetOneById returns recipient by id
+	GetOneById(id uint32) (model.Recipient, error)
 	//GetOneByMessageIdAndPhone returns a recipient with the given message id and phone
 	GetOneByMessageIdAndPhone(messageId uint32, phone string) (model.Recipient, error)
 	//GetAllByMessageId returns all recipients with the given message id
 	GetAllByMessageId(messageId uint32) ([]model.Recipient, error)
+	//GetAllByStatus returns all recipients with any of the given statuses
+	GetAllByStatus(statuses ...string) ([]model.Recipient, error)
 	//GetAll returns all recipients
 	GetAll() ([]model.Recipient, error)
 	//RemoveOlderThanDays removes all recipients older that {days}
@@ -41,13 +48,13 @@ func (r recipientDao) RemoveOlderThanDays(days int) error {
 	return nil
 }
 
-func (r recipientDao) Create(messageId uint32, phone string) (uint32, error) {
-	recipient := &model.Recipient{MessageId: messageId, Phone: phone, Status: model.NEW, CreatedAt: time.Now()}
+func (r recipientDao) Create(messageId uint32, phone, status string) (uint32, error) {
+	recipient := &model.Recipient{MessageId: messageId, Phone: phone, Status: status, CreatedAt: time.Now()}
 	err := r.db.Save(recipient)
 	return recipient.Id, err
 }
 
-func (r recipientDao) UpdateSubmitStatus(id uint32, deliverId string, status string) error {
+func (r recipientDao) UpdateSubmitStatus(id uint32, deliverId, status, route string) error {
 	//update status based on SUBMIT_SM_RESP status
 	var recipient model.Recipient
 	err := r.db.One("Id", id, &recipient)
@@ -55,22 +62,60 @@ func (r recipientDao) UpdateSubmitStatus(id uint32, deliverId string, status str
 		return err
 	}
 	recipient.DeliverId = strings.ToUpper(deliverId)
-	recipient.Status = status
-	return r.db.Update(&recipient)
+	recipient.Route = route
+	transitionErr := changeStatus(&recipient.Status, status)
+	err = r.db.Update(&recipient)
+	if err != nil {
+		return err
+	}
+	return transitionErr
 }
 
-func (r recipientDao) UpdateDeliverStatus(deliverId string, status string) (uint32, string, error) {
+func (r recipientDao) UpdateDeliverStatus(deliverId, status, errorCode string, doneAt time.Time) (uint32, string, error) {
 	//update status based on DELIVER_SM
 	var recipient model.Recipient
 	err := r.db.One("DeliverId", strings.ToUpper(deliverId), &recipient)
 	if err != nil {
 		return 0, "", err
 	}
-	recipient.Status = status
+	err = changeStatus(&recipient.Status, status)
+	if err != nil {
+		return recipient.MessageId, recipient.Phone, err
+	}
+	recipient.ErrorCode = errorCode
+	recipient.DoneAt = doneAt
 	err = r.db.Update(&recipient)
 	return recipient.MessageId, recipient.Phone, err
 }
 
+func (r recipientDao) UpdateStatus(id uint32, status, errorCode string, doneAt time.Time) (uint32, string, error) {
+	var recipient model.Recipient
+	err := r.db.One("Id", id, &recipient)
+	if err != nil {
+		return 0, "", err
+	}
+	err = changeStatus(&recipient.Status, status)
+	if err != nil {
+		return recipient.MessageId, recipient.Phone, err
+	}
+	recipient.ErrorCode = errorCode
+	recipient.DoneAt = doneAt
+	err = r.db.Update(&recipient)
+	return recipient.MessageId, recipient.Phone, err
+}
+
+// changeStatus sets status if the state machine allows it, repeated status is not an error
+func changeStatus(current *string, status string) error {
+	if *current == status {
+		return nil
+	}
+	if !model.CanChangeStatus(*current, status) {
+		return model.IgnoredTransitionErr{From: *current, To: status}
+	}
+	*current = status
+	return nil
+}
+
 func (r recipientDao) GetOneByMessageIdAndPhone(messageId uint32, phone string) (model.Recipient, error) {
 	var matchers []q.Matcher
 	matchers = append(matchers, q.Eq("MessageId", messageId))
@@ -93,6 +138,19 @@ func (r recipientDao) GetAllByMessageId(messageId uint32) (recipients []model.Re
 	return
 }
 
+func (r recipientDao) GetOneById(id uint32) (recipient model.Recipient, err error) {
+	err = r.db.One("Id", id, &recipient)
+	return
+}
+
+func (r recipientDao) GetAllByStatus(statuses ...string) (recipients []model.Recipient, err error) {
+	err = r.db.Select(q.In("Status", statuses)).Find(&recipients)
+	if err != nil && err.Error() == "not found" {
+		return []model.Recipient{}, nil
+	}
+	return
+}
+
 func (r recipientDao) GetAll() (recipients []model.Recipient, err error) {
 	err = r.db.All(&recipients)
 	return
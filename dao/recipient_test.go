@@ -15,6 +15,7 @@ const (
 	PHONE1     = "996YYYAABBCC"
 	PHONE2     = "999ZZZXXXXXX"
 	DELIVER_ID = "1234"
+	ERROR_CODE = "034"
 )
 
 func prepareDB2(t errorHandler) (Db, func()) {
@@ -42,10 +43,14 @@ func TestRecipientDao_Create(t *testing.T) {
 	defer cleanup()
 	recDao := NewRecipientDao(db)
 
-	id, err := recDao.Create(MSG_ID1, PHONE1)
+	id, err := recDao.Create(MSG_ID1, PHONE1, model.SCHEDULED)
 
 	require.NoError(t, err)
 	require.True(t, id > 0)
+
+	one, _ := recDao.GetOneByMessageIdAndPhone(MSG_ID1, PHONE1)
+
+	require.Equal(t, model.SCHEDULED, one.Status)
 }
 
 func TestRecipientDao_GetAll(t *testing.T) {
@@ -71,6 +76,41 @@ func TestRecipientDao_GetAllByMessageId(t *testing.T) {
 	require.Equal(t, PHONE2, all[0].Phone)
 }
 
+func TestRecipientDao_GetAllByStatus(t *testing.T) {
+	db, cleanup := prepareDB2(t)
+	defer cleanup()
+	recDao := NewRecipientDao(db)
+
+	all, err := recDao.GetAllByStatus(model.SUBMIT_OK, model.ENROUTE)
+
+	require.NoError(t, err)
+	require.Empty(t, all)
+
+	_ = recDao.UpdateSubmitStatus(ID1, DELIVER_ID, model.SUBMIT_OK, ROUTE)
+	_ = recDao.UpdateSubmitStatus(ID2, DELIVER_ID2, model.SUBMIT_FAIL, ROUTE)
+
+	all, err = recDao.GetAllByStatus(model.SUBMIT_OK, model.ENROUTE)
+
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, ID1, all[0].Id)
+}
+
+func TestRecipientDao_GetOneById(t *testing.T) {
+	db, cleanup := prepareDB2(t)
+	defer cleanup()
+	recDao := NewRecipientDao(db)
+
+	one, err := recDao.GetOneById(ID2)
+
+	require.NoError(t, err)
+	require.Equal(t, PHONE2, one.Phone)
+
+	_, err = recDao.GetOneById(ID2 + 100)
+
+	require.Error(t, err)
+}
+
 func TestRecipientDao_GetOneByMessageIdAndPhone(t *testing.T) {
 	db, cleanup := prepareDB2(t)
 	defer cleanup()
@@ -88,7 +128,7 @@ func TestRecipientDao_UpdateSubmitStatus(t *testing.T) {
 	defer cleanup()
 	recDao := NewRecipientDao(db)
 
-	err := recDao.UpdateSubmitStatus(ID1, DELIVER_ID, model.ACCEPTD)
+	err := recDao.UpdateSubmitStatus(ID1, DELIVER_ID, model.ACCEPTD, ROUTE)
 
 	require.NoError(t, err)
 
@@ -96,15 +136,16 @@ func TestRecipientDao_UpdateSubmitStatus(t *testing.T) {
 
 	require.Equal(t, DELIVER_ID, one.DeliverId)
 	require.Equal(t, model.ACCEPTD, one.Status)
+	require.Equal(t, ROUTE, one.Route)
 }
 
 func TestRecipientDao_UpdateDeliverStatus(t *testing.T) {
 	db, cleanup := prepareDB2(t)
 	defer cleanup()
 	recDao := NewRecipientDao(db)
-	_ = recDao.UpdateSubmitStatus(ID1, DELIVER_ID, model.ACCEPTD)
+	_ = recDao.UpdateSubmitStatus(ID1, DELIVER_ID, model.ACCEPTD, ROUTE)
 
-	msgId, phone, err := recDao.UpdateDeliverStatus(DELIVER_ID, model.DELIVRD)
+	msgId, phone, err := recDao.UpdateDeliverStatus(DELIVER_ID, model.DELIVRD, "000", time.Now())
 
 	require.True(t, len(phone) > 0)
 	require.NoError(t, err)
@@ -114,6 +155,39 @@ func TestRecipientDao_UpdateDeliverStatus(t *testing.T) {
 
 	require.Equal(t, DELIVER_ID, one.DeliverId)
 	require.Equal(t, model.DELIVRD, one.Status)
+	require.False(t, one.DoneAt.IsZero())
+
+	//intermediate receipt after the final one
+	_, _, err = recDao.UpdateDeliverStatus(DELIVER_ID, model.ENROUTE, "", time.Time{})
+
+	require.Error(t, err)
+
+	//late submit response keeps the final status but stores delivery id
+	err = recDao.UpdateSubmitStatus(ID1, "5678", model.SUBMIT_OK, ROUTE)
+
+	require.Equal(t, model.IgnoredTransitionErr{From: model.DELIVRD, To: model.SUBMIT_OK}, err)
+
+	one, _ = recDao.GetOneByMessageIdAndPhone(MSG_ID1, PHONE1)
+
+	require.Equal(t, model.DELIVRD, one.Status)
+	require.Equal(t, "5678", one.DeliverId)
+}
+
+func TestRecipientDao_UpdateStatus(t *testing.T) {
+	db, cleanup := prepareDB2(t)
+	defer cleanup()
+	recDao := NewRecipientDao(db)
+
+	msgId, phone, err := recDao.UpdateStatus(ID1, model.UNDELIV, ERROR_CODE, time.Time{})
+
+	require.NoError(t, err)
+	require.Equal(t, MSG_ID1, msgId)
+	require.Equal(t, PHONE1, phone)
+
+	one, _ := recDao.GetOneByMessageIdAndPhone(MSG_ID1, PHONE1)
+
+	require.Equal(t, model.UNDELIV, one.Status)
+	require.Equal(t, ERROR_CODE, one.ErrorCode)
 }
 
 func TestRecipientDao_RemoveOlderThanDays(t *testing.T) {
@@ -0,0 +1,42 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/dilshat/sms-sender/model"
+)
+
+type ScheduleDao interface {
+	//Create schedules sending of the message with the given id
+	Create(messageId uint32, sendAt, expiresAt time.Time) error
+	//GetDue returns schedules with send time not later than {now}, earliest first
+	GetDue(now time.Time) ([]model.Schedule, error)
+	//RemoveByMessageId removes schedule of the message, returns "not found" error if there is none
+	RemoveByMessageId(messageId uint32) error
+}
+
+func NewScheduleDao(db Db) ScheduleDao {
+	return &scheduleDao{db: db}
+}
+
+type scheduleDao struct {
+	db Db
+}
+
+func (s scheduleDao) Create(messageId uint32, sendAt, expiresAt time.Time) error {
+	schedule := &model.Schedule{MessageId: messageId, SendAt: sendAt, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	return s.db.Save(schedule)
+}
+
+func (s scheduleDao) GetDue(now time.Time) (schedules []model.Schedule, err error) {
+	err = s.db.Select(q.Lte("SendAt", now)).OrderBy("SendAt").Find(&schedules)
+	if err != nil && err.Error() == "not found" {
+		return []model.Schedule{}, nil
+	}
+	return
+}
+
+func (s scheduleDao) RemoveByMessageId(messageId uint32) error {
+	return s.db.Select(q.Eq("MessageId", messageId)).Delete(&model.Schedule{})
+}
@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleDao_GetDue(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	schDao := NewScheduleDao(db)
+	now := time.Now()
+
+	due, err := schDao.GetDue(now)
+
+	require.NoError(t, err)
+	require.Equal(t, 0, len(due))
+
+	_ = schDao.Create(MSG_ID1, now.Add(time.Hour), time.Time{})
+	_ = schDao.Create(MSG_ID2, now.Add(-time.Minute), now.Add(time.Hour))
+
+	due, err = schDao.GetDue(now)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, len(due))
+	require.Equal(t, MSG_ID2, due[0].MessageId)
+	require.False(t, due[0].ExpiresAt.IsZero())
+}
+
+func TestScheduleDao_RemoveByMessageId(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	schDao := NewScheduleDao(db)
+	_ = schDao.Create(MSG_ID1, time.Now(), time.Time{})
+
+	err := schDao.RemoveByMessageId(MSG_ID1)
+
+	require.NoError(t, err)
+
+	//schedule can be removed only once
+	err = schDao.RemoveByMessageId(MSG_ID1)
+
+	require.Error(t, err)
+	require.Equal(t, "not found", err.Error())
+}
@@ -0,0 +1,90 @@
+package dao
+
+import (
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/dilshat/sms-sender/model"
+)
+
+type SegmentDao interface {
+	//UpdateSubmitStatus creates or updates segment {partNo} of recipient with the given id,
+	//status regressions are not applied and reported with model.IgnoredTransitionErr
+	UpdateSubmitStatus(recipientId uint32, partNo, partsCount int, deliverId string, status string) error
+	//UpdateDeliverStatus updates status, error code and done date of segment with the delivery id and returns id of its recipient
+	UpdateDeliverStatus(deliverId, status, errorCode string, doneAt time.Time) (uint32, error)
+	//GetAllByRecipientId returns all segments of recipient with the given id
+	GetAllByRecipientId(recipientId uint32) ([]model.Segment, error)
+	//GetAllByStatus returns all segments with any of the given statuses
+	GetAllByStatus(statuses ...string) ([]model.Segment, error)
+	//RemoveOlderThanDays removes all segments older than {days}
+	RemoveOlderThanDays(days int) error
+}
+
+func NewSegmentDao(db Db) SegmentDao {
+	return &segmentDao{db: db}
+}
+
+type segmentDao struct {
+	db Db
+}
+
+func (s segmentDao) RemoveOlderThanDays(days int) error {
+	err := s.db.Select(q.Lt("CreatedAt", time.Now().Add(-24*time.Duration(days)*time.Hour))).Delete(&model.Segment{})
+	if err != nil && err.Error() != "not found" {
+		return err
+	}
+	return nil
+}
+
+func (s segmentDao) UpdateSubmitStatus(recipientId uint32, partNo, partsCount int, deliverId string, status string) error {
+	var segments []model.Segment
+	err := s.db.Select(q.Eq("RecipientId", recipientId), q.Eq("PartNo", partNo)).Limit(1).Find(&segments)
+	if err != nil && err.Error() != "not found" {
+		return err
+	}
+
+	segment := model.Segment{RecipientId: recipientId, PartNo: partNo, Status: model.NEW, CreatedAt: time.Now()}
+	if len(segments) > 0 {
+		segment = segments[0]
+	}
+	segment.PartsCount = partsCount
+	segment.DeliverId = strings.ToUpper(deliverId)
+	transitionErr := changeStatus(&segment.Status, status)
+
+	err = s.db.Save(&segment)
+	if err != nil {
+		return err
+	}
+	return transitionErr
+}
+
+func (s segmentDao) UpdateDeliverStatus(deliverId, status, errorCode string, doneAt time.Time) (uint32, error) {
+	var segment model.Segment
+	err := s.db.One("DeliverId", strings.ToUpper(deliverId), &segment)
+	if err != nil {
+		return 0, err
+	}
+	err = changeStatus(&segment.Status, status)
+	if err != nil {
+		return segment.RecipientId, err
+	}
+	segment.ErrorCode = errorCode
+	segment.DoneAt = doneAt
+	err = s.db.Update(&segment)
+	return segment.RecipientId, err
+}
+
+func (s segmentDao) GetAllByRecipientId(recipientId uint32) (segments []model.Segment, err error) {
+	err = s.db.Find("RecipientId", recipientId, &segments)
+	return
+}
+
+func (s segmentDao) GetAllByStatus(statuses ...string) (segments []model.Segment, err error) {
+	err = s.db.Select(q.In("Status", statuses)).Find(&segments)
+	if err != nil && err.Error() == "not found" {
+		return []model.Segment{}, nil
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	DELIVER_ID2 = "ABCD"
+)
+
+func TestSegmentDao_UpdateSubmitStatus(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	segDao := NewSegmentDao(db)
+
+	err := segDao.UpdateSubmitStatus(MSG_ID1, 1, 2, DELIVER_ID, model.SUBMIT_OK)
+
+	require.NoError(t, err)
+
+	err = segDao.UpdateSubmitStatus(MSG_ID1, 2, 2, "abcd", model.SUBMIT_FAIL)
+
+	require.NoError(t, err)
+
+	//repeated response updates the same segment but does not change its status
+	err = segDao.UpdateSubmitStatus(MSG_ID1, 2, 2, "abcd", model.SUBMIT_OK)
+
+	require.Equal(t, model.IgnoredTransitionErr{From: model.SUBMIT_FAIL, To: model.SUBMIT_OK}, err)
+
+	segments, err := segDao.GetAllByRecipientId(MSG_ID1)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, len(segments))
+	require.Equal(t, DELIVER_ID2, segments[1].DeliverId)
+	require.Equal(t, model.SUBMIT_FAIL, segments[1].Status)
+}
+
+func TestSegmentDao_UpdateDeliverStatus(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	segDao := NewSegmentDao(db)
+	_ = segDao.UpdateSubmitStatus(MSG_ID1, 1, 1, DELIVER_ID2, model.SUBMIT_OK)
+
+	recipientId, err := segDao.UpdateDeliverStatus("abcd", model.UNDELIV, ERROR_CODE, time.Now())
+
+	require.NoError(t, err)
+	require.Equal(t, MSG_ID1, recipientId)
+
+	segments, _ := segDao.GetAllByRecipientId(MSG_ID1)
+
+	require.Equal(t, model.UNDELIV, segments[0].Status)
+	require.Equal(t, ERROR_CODE, segments[0].ErrorCode)
+
+	_, err = segDao.UpdateDeliverStatus("ffff", model.DELIVRD, "", time.Time{})
+
+	require.Error(t, err)
+}
+
+func TestSegmentDao_GetAllByStatus(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	segDao := NewSegmentDao(db)
+
+	all, err := segDao.GetAllByStatus(model.SUBMIT_OK, model.ENROUTE)
+
+	require.NoError(t, err)
+	require.Empty(t, all)
+
+	_ = segDao.UpdateSubmitStatus(MSG_ID1, 1, 2, DELIVER_ID, model.SUBMIT_OK)
+	_ = segDao.UpdateSubmitStatus(MSG_ID1, 2, 2, DELIVER_ID2, model.SUBMIT_FAIL)
+
+	all, err = segDao.GetAllByStatus(model.SUBMIT_OK, model.ENROUTE)
+
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, DELIVER_ID, all[0].DeliverId)
+}
+
+func TestSegmentDao_GetAllByRecipientId(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	segDao := NewSegmentDao(db)
+
+	_, err := segDao.GetAllByRecipientId(MSG_ID1)
+
+	require.Error(t, err)
+
+	_ = segDao.UpdateSubmitStatus(MSG_ID1, 1, 1, DELIVER_ID, model.SUBMIT_OK)
+	_ = segDao.UpdateSubmitStatus(MSG_ID2, 1, 1, DELIVER_ID2, model.SUBMIT_OK)
+
+	segments, err := segDao.GetAllByRecipientId(MSG_ID1)
+
+	require.NoError(t, err)
+	require.Equal(t, 1, len(segments))
+	require.Equal(t, DELIVER_ID, segments[0].DeliverId)
+}
+
+func TestSegmentDao_RemoveOlderThanDays(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	segDao := NewSegmentDao(db)
+	_ = segDao.UpdateSubmitStatus(MSG_ID1, 1, 1, DELIVER_ID, model.SUBMIT_OK)
+
+	err := segDao.RemoveOlderThanDays(1)
+
+	require.NoError(t, err)
+
+	segments, _ := segDao.GetAllByRecipientId(MSG_ID1)
+
+	require.Equal(t, 1, len(segments))
+}
@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/asdine/storm/v3/q"
+	"github.com/dilshat/sms-sender/model"
+)
+
+type StatusEventDao interface {
+	//Create appends status event to the history of recipient with the given id
+	Create(recipientId uint32, partNo int, status, smscId, errorCode string, ignored bool) error
+	//GetAllByRecipientId returns history of recipient with the given id, oldest first
+	GetAllByRecipientId(recipientId uint32) ([]model.StatusEvent, error)
+	//RemoveOlderThanDays removes all status events older than {days}
+	RemoveOlderThanDays(days int) error
+}
+
+func NewStatusEventDao(db Db) StatusEventDao {
+	return &statusEventDao{db: db}
+}
+
+type statusEventDao struct {
+	db Db
+}
+
+func (s statusEventDao) RemoveOlderThanDays(days int) error {
+	err := s.db.Select(q.Lt("CreatedAt", time.Now().Add(-24*time.Duration(days)*time.Hour))).Delete(&model.StatusEvent{})
+	if err != nil && err.Error() != "not found" {
+		return err
+	}
+	return nil
+}
+
+func (s statusEventDao) Create(recipientId uint32, partNo int, status, smscId, errorCode string, ignored bool) error {
+	event := &model.StatusEvent{RecipientId: recipientId, PartNo: partNo, Status: status, SmscId: smscId, ErrorCode: errorCode, Ignored: ignored, CreatedAt: time.Now()}
+	return s.db.Save(event)
+}
+
+func (s statusEventDao) GetAllByRecipientId(recipientId uint32) (events []model.StatusEvent, err error) {
+	err = s.db.Select(q.Eq("RecipientId", recipientId)).OrderBy("Id").Find(&events)
+	if err != nil && err.Error() == "not found" {
+		return []model.StatusEvent{}, nil
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusEventDao_GetAllByRecipientId(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	evDao := NewStatusEventDao(db)
+
+	events, err := evDao.GetAllByRecipientId(MSG_ID1)
+
+	require.NoError(t, err)
+	require.Equal(t, 0, len(events))
+
+	_ = evDao.Create(MSG_ID1, 1, model.SUBMIT_OK, DELIVER_ID, "", false)
+	_ = evDao.Create(MSG_ID2, 1, model.SUBMIT_OK, DELIVER_ID2, "", false)
+	_ = evDao.Create(MSG_ID1, 0, model.UNDELIV, DELIVER_ID, ERROR_CODE, false)
+
+	events, err = evDao.GetAllByRecipientId(MSG_ID1)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, len(events))
+	//oldest first
+	require.Equal(t, model.SUBMIT_OK, events[0].Status)
+	require.Equal(t, 1, events[0].PartNo)
+	require.Equal(t, ERROR_CODE, events[1].ErrorCode)
+}
+
+func TestStatusEventDao_RemoveOlderThanDays(t *testing.T) {
+	db, cleanup := createDB(t)
+	defer cleanup()
+	evDao := NewStatusEventDao(db)
+	_ = evDao.Create(MSG_ID1, 1, model.SUBMIT_OK, DELIVER_ID, "", false)
+
+	err := evDao.RemoveOlderThanDays(1)
+
+	require.NoError(t, err)
+
+	events, _ := evDao.GetAllByRecipientId(MSG_ID1)
+
+	require.Equal(t, 1, len(events))
+}
@@ -1,6 +1,6 @@
 // GENERATED BY THE COMMAND ABOVE; DO NOT EDIT
 // This file was generated by swaggo/swag at
-// 2019-11-28 10:47:31.8042211 +0600 +06 m=+0.054000201
+// 2026-10-18 12:05:09.597877448 +0000 UTC m=+0.057764016
 
 package docs
 
@@ -29,6 +29,43 @@ var doc = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/inbound": {
+            "get": {
+                "description": "Returns latest messages received from subscribers, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get inbound sms",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Phone number",
+                        "name": "phone",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Max number of messages, 100 by default",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.InboundMessage"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "error description"
+                    }
+                }
+            }
+        },
         "/sms": {
             "post": {
                 "description": "Sends sms message to specified phones",
@@ -46,7 +83,6 @@ var doc = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "object",
                             "$ref": "#/definitions/dto.Message"
                         }
                     }
@@ -84,6 +120,12 @@ var doc = `{
                         "description": "Phone number",
                         "name": "phone",
                         "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return status history and latencies of every phone",
+                        "name": "history",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -97,6 +139,87 @@ var doc = `{
                         "description": "error description"
                     }
                 }
+            },
+            "delete": {
+                "description": "Cancels sms message not delivered yet: removes it from the schedule or the outgoing queue,\nsubmitted messages are cancelled at SMSC",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Cancel sms",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Message id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Phone number",
+                        "name": "phone",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OperationResult"
+                        }
+                    },
+                    "404": {
+                        "description": "error description"
+                    }
+                }
+            },
+            "patch": {
+                "description": "Replaces text of sms message not delivered yet, submitted messages are replaced at SMSC",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Replace sms",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Message id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Phone number",
+                        "name": "phone",
+                        "in": "query"
+                    },
+                    {
+                        "description": "New text",
+                        "name": "text",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.Replacement"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.OperationResult"
+                        }
+                    },
+                    "400": {
+                        "description": "error description"
+                    },
+                    "404": {
+                        "description": "error description"
+                    }
+                }
             }
         }
     },
@@ -109,20 +232,93 @@ var doc = `{
                 }
             }
         },
+        "dto.InboundMessage": {
+            "type": "object",
+            "properties": {
+                "destination": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "partial": {
+                    "type": "boolean"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "received_at": {
+                    "type": "string"
+                },
+                "route": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
         "dto.Message": {
             "type": "object",
             "properties": {
+                "class": {
+                    "description": "Class is \"flash\" for class 0 messages, \"silent\" for type 0 messages or empty for normal messages",
+                    "type": "string"
+                },
+                "deliver_at": {
+                    "description": "DeliverAt is the time SMSC delivers the submitted message at",
+                    "type": "string"
+                },
+                "destination_port": {
+                    "type": "integer"
+                },
+                "encoding": {
+                    "description": "Encoding of binary payload is \"hex\" (default) or \"base64\"",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "description": "ExpiresAt is the time after which the scheduled message is not sent anymore, allowed only with SendAt",
+                    "type": "string"
+                },
                 "phones": {
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
+                "priority": {
+                    "description": "Priority is priority_flag of submit_sm from 0 to 3",
+                    "type": "integer"
+                },
+                "protocol_id": {
+                    "description": "ProtocolId is protocol_id of submit_sm from 0 to 255",
+                    "type": "integer"
+                },
+                "replace_if_present": {
+                    "description": "ReplaceIfPresent makes SMSC replace undelivered message from the same sender, single part messages only",
+                    "type": "boolean"
+                },
+                "send_at": {
+                    "description": "SendAt is the time to send the message at, it is sent immediately if omitted",
+                    "type": "string"
+                },
                 "sender": {
                     "type": "string"
                 },
+                "source_port": {
+                    "description": "SourcePort and DestinationPort address an application on the handset, binary messages only",
+                    "type": "integer"
+                },
                 "text": {
                     "type": "string"
+                },
+                "type": {
+                    "description": "Type is \"binary\" for 8-bit data messages carrying payload in the text, \"text\" by default",
+                    "type": "string"
+                },
+                "validity_period": {
+                    "description": "ValidityPeriod is the time after which SMSC stops delivery attempts",
+                    "type": "string"
                 }
             }
         },
@@ -146,14 +342,102 @@ var doc = `{
                 }
             }
         },
+        "dto.OperationResult": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "recipients": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.RecipientResult"
+                    }
+                }
+            }
+        },
+        "dto.RecipientResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Error tells why the operation failed for the recipient",
+                    "type": "string"
+                },
+                "ok": {
+                    "type": "boolean"
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status is the status of the recipient after the operation",
+                    "type": "string"
+                }
+            }
+        },
         "dto.RecipientStatus": {
             "type": "object",
             "properties": {
+                "delivery_latency_ms": {
+                    "description": "DeliveryLatencyMs is time from submit till the final delivery receipt",
+                    "type": "integer"
+                },
+                "done_at": {
+                    "type": "string"
+                },
+                "error_code": {
+                    "type": "string"
+                },
+                "history": {
+                    "description": "History, SubmitLatencyMs and DeliveryLatencyMs are returned on request",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.StatusEvent"
+                    }
+                },
                 "phone": {
                     "type": "string"
                 },
+                "route": {
+                    "type": "string"
+                },
                 "status": {
                     "type": "string"
+                },
+                "submit_latency_ms": {
+                    "description": "SubmitLatencyMs is time from acceptance of the message, or from its send_at if scheduled, till submit of its last part",
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.Replacement": {
+            "type": "object",
+            "properties": {
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.StatusEvent": {
+            "type": "object",
+            "properties": {
+                "error_code": {
+                    "type": "string"
+                },
+                "ignored": {
+                    "type": "boolean"
+                },
+                "part_no": {
+                    "type": "integer"
+                },
+                "smsc_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
                 }
             }
         }
@@ -9,7 +9,6 @@ require (
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
 	github.com/asdine/storm v2.1.2+incompatible
 	github.com/asdine/storm/v3 v3.1.1
-	github.com/cskr/pubsub v1.0.2
 	github.com/dchest/uniuri v0.0.0-20160212164326-8902c56451e9
 	github.com/go-openapi/spec v0.19.7 // indirect
 	github.com/go-openapi/swag v0.19.8 // indirect
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"strings"
 
 	"github.com/dilshat/sms-sender/controller"
 	"github.com/dilshat/sms-sender/dao"
@@ -63,15 +65,13 @@ func main() {
 		zap.L().Fatal("Error connecting to db", zap.Error(err))
 	}
 
-	//create smpp client
-	smppClient := sms.NewClient(util.GetEnv("SMS_IP", ""),
-		util.GetEnvAsInt("SMS_PORT", 8018),
-		util.GetEnv("SMS_ID", ""),
-		util.GetEnv("SMS_PWD", ""),
-		util.GetEnvAsInt("ENQ_LNK_SEC", 30),
-		util.GetEnvAsInt("TRX_PER_SEC", 100))
+	//create smpp clients
+	router, err := createRouter()
+	if err != nil {
+		zap.L().Fatal("Error configuring SMSC routes", zap.Error(err))
+	}
 
-	smsSender := sms.NewSender(smppClient)
+	smsSender := sms.NewSender(router, dao.NewOutgoingDao(dbClient))
 
 	//start sms sender
 	err = smsSender.Start()
@@ -83,9 +83,19 @@ func main() {
 		smsSender,
 		dao.NewMessageDao(dbClient),
 		dao.NewRecipientDao(dbClient),
+		dao.NewSegmentDao(dbClient),
+		dao.NewInboundDao(dbClient),
+		dao.NewPendingReceiptDao(dbClient),
+		dao.NewStatusEventDao(dbClient),
+		dao.NewScheduleDao(dbClient),
 		util.GetEnvAsInt("STATUS_STORE_DAYS", 7),
+		util.GetEnvAsInt("PENDING_RECEIPT_EXPIRY_MIN", 60),
+		util.GetEnvAsInt("STATUS_QUERY_DELAY_MIN", 0),
+		util.GetEnvAsInt("STATUS_DEADLINE_HOURS", 0),
 		util.GetEnvAsInt("SMS_MAX_LEN", 300),
+		util.GetEnvAsInt("SMS_MAX_BYTES", 300),
 		util.GetEnv("WEB_HOOK", ""),
+		util.GetEnv("INBOUND_WEB_HOOK", ""),
 		util.GetEnv("PHONE_MASK", "996\\d{9}"),
 	)
 
@@ -102,9 +112,100 @@ func main() {
 	zap.L().Fatal("Error starting http server", zap.Error(err))
 }
 
+// createRouter creates an SMPP client per SMSC listed in SMSC_ROUTES;
+// settings of SMSC "name" are read from SMSC_NAME_* variables.
+// Without SMSC_ROUTES a single default client is created from SMS_* variables
+func createRouter() (sms.Router, error) {
+	//settings shared by all SMSC connections, TON/NPI of source address are detected from the sender unless set
+	defaults := sms.ClientConfig{
+		EnquireLinkSec:   util.GetEnvAsInt("ENQ_LNK_SEC", 30),
+		Tps:              util.GetEnvAsInt("TRX_PER_SEC", 100),
+		Window:           util.GetEnvAsInt("SUBMIT_WINDOW", 10),
+		SubmitTimeoutSec: util.GetEnvAsInt("SUBMIT_TIMEOUT_SEC", 60),
+		ConcatMode:       util.GetEnv("CONCAT_MODE", sms.CONCAT_UDH8),
+		SourceTon:        util.GetEnvAsOptionalInt("SOURCE_TON", nil),
+		SourceNpi:        util.GetEnvAsOptionalInt("SOURCE_NPI", nil),
+		Bind: sms.BindConfig{
+			Mode:             util.GetEnv("BIND_MODE", sms.BIND_MODE_TRX),
+			SystemType:       util.GetEnv("SYSTEM_TYPE", ""),
+			InterfaceVersion: util.GetEnvAsInt("INTERFACE_VERSION", 0),
+			AddressRange:     util.GetEnv("ADDRESS_RANGE", ""),
+		},
+	}
+
+	names := util.GetEnvAsList("SMSC_ROUTES", nil)
+	if len(names) == 0 {
+		config := defaults
+		config.Host = util.GetEnv("SMS_IP", "")
+		config.Port = util.GetEnvAsInt("SMS_PORT", 8018)
+		config.SystemId = util.GetEnv("SMS_ID", "")
+		config.Password = util.GetEnv("SMS_PWD", "")
+		err := checkConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		return sms.NewRouter([]sms.Route{{Name: "default", Client: sms.NewClient(config)}}, "default")
+	}
+
+	var routes []sms.Route
+	for _, name := range names {
+		prefix := "SMSC_" + strings.ToUpper(name) + "_"
+		config, err := routeConfig(prefix, defaults)
+		if err != nil {
+			return nil, errors.New("SMSC route " + name + ": " + err.Error())
+		}
+		routes = append(routes, sms.Route{
+			Name:     name,
+			Client:   sms.NewClient(config),
+			Prefixes: util.GetEnvAsList(prefix+"PREFIXES", nil),
+			Backup:   util.GetEnv(prefix+"BACKUP", ""),
+		})
+	}
+
+	return sms.NewRouter(routes, util.GetEnv("SMSC_DEFAULT_ROUTE", ""))
+}
+
+// routeConfig reads settings of SMSC connection from variables with the prefix, unset ones are taken from defaults
+func routeConfig(prefix string, defaults sms.ClientConfig) (sms.ClientConfig, error) {
+	config := sms.ClientConfig{
+		Host:             util.GetEnv(prefix+"IP", ""),
+		Port:             util.GetEnvAsInt(prefix+"PORT", 8018),
+		SystemId:         util.GetEnv(prefix+"ID", ""),
+		Password:         util.GetEnv(prefix+"PWD", ""),
+		EnquireLinkSec:   util.GetEnvAsInt(prefix+"ENQ_LNK_SEC", defaults.EnquireLinkSec),
+		Tps:              util.GetEnvAsInt(prefix+"TRX_PER_SEC", defaults.Tps),
+		Window:           util.GetEnvAsInt(prefix+"SUBMIT_WINDOW", defaults.Window),
+		SubmitTimeoutSec: util.GetEnvAsInt(prefix+"SUBMIT_TIMEOUT_SEC", defaults.SubmitTimeoutSec),
+		ConcatMode:       util.GetEnv(prefix+"CONCAT_MODE", defaults.ConcatMode),
+		SourceTon:        util.GetEnvAsOptionalInt(prefix+"SOURCE_TON", defaults.SourceTon),
+		SourceNpi:        util.GetEnvAsOptionalInt(prefix+"SOURCE_NPI", defaults.SourceNpi),
+		Bind: sms.BindConfig{
+			Mode:             util.GetEnv(prefix+"BIND_MODE", defaults.Bind.Mode),
+			SystemType:       util.GetEnv(prefix+"SYSTEM_TYPE", defaults.Bind.SystemType),
+			InterfaceVersion: util.GetEnvAsInt(prefix+"INTERFACE_VERSION", defaults.Bind.InterfaceVersion),
+			AddressRange:     util.GetEnv(prefix+"ADDRESS_RANGE", defaults.Bind.AddressRange),
+		},
+	}
+	return config, checkConfig(config)
+}
+
+// checkConfig rejects settings of SMSC connection which can not work
+func checkConfig(config sms.ClientConfig) error {
+	if config.SubmitTimeoutSec <= 0 {
+		return errors.New("SUBMIT_TIMEOUT_SEC must be positive")
+	}
+	return nil
+}
+
 func bindRoutes(e *echo.Echo, service service.Service) {
 
 	e.POST("/sms", controller.GetSendSmsFunc(service))
 
 	e.GET("/sms/:id", controller.GetCheckSmsFunc(service))
+
+	e.DELETE("/sms/:id", controller.GetCancelSmsFunc(service))
+
+	e.PATCH("/sms/:id", controller.GetReplaceSmsFunc(service))
+
+	e.GET("/inbound", controller.GetInboundFunc(service))
 }
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Inbound is a mobile originated message received from a subscriber
+type Inbound struct {
+	Id          uint32 `storm:"id,increment"`
+	Source      string `storm:"index"`
+	Destination string
+	Text        string
+	Route       string
+	//Partial is set if some parts of a concatenated message were not received
+	Partial   bool
+	CreatedAt time.Time `storm:"index"`
+}
@@ -2,9 +2,37 @@ package model
 
 import "time"
 
+const (
+	//class 0 message displayed immediately and not stored by the handset
+	CLASS_FLASH string = "flash"
+	//type 0 short message acknowledged and discarded by the handset
+	CLASS_SILENT = "silent"
+)
+
 type Message struct {
 	Id        uint32 `storm:"id,increment"`
 	Text      string
 	Sender    string
+	Options   SubmitOptions
 	CreatedAt time.Time `storm:"index"`
 }
+
+// SubmitOptions are optional submit_sm parameters of a message, zero values are left to SMSC defaults
+type SubmitOptions struct {
+	//ValidityPeriod is the time after which SMSC stops delivery attempts
+	ValidityPeriod time.Time
+	//DeliverAt is the schedule_delivery_time, SMSC holds the submitted message until then
+	DeliverAt time.Time
+	//Priority is the priority_flag from 0 (lowest) to 3
+	Priority   int
+	ProtocolId int
+	//ReplaceIfPresent makes SMSC replace an undelivered message with the same source and destination
+	ReplaceIfPresent bool
+	//Class is CLASS_FLASH, CLASS_SILENT or empty for normal messages
+	Class string
+	//Binary messages carry hex encoded 8-bit data in the text
+	Binary bool
+	//SourcePort and DestinationPort address an application on the handset, zero if not set
+	SourcePort      int
+	DestinationPort int
+}
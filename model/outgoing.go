@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// Outgoing is a persisted entry of the outbound queue, it is removed once submit results of all its parts are handled
+type Outgoing struct {
+	Id          uint32 `storm:"id,increment"`
+	RecipientId uint32 `storm:"index"`
+	Route       string `storm:"index"`
+	Sender      string
+	Phone       string
+	Text        string
+	Options     SubmitOptions
+	Attempts    int
+	//InFlight is set while the message is submitted and results of its parts are awaited,
+	//such messages are queued again after restart
+	InFlight bool
+	//Done is the number of parts with final submit result
+	Done      int
+	CreatedAt time.Time `storm:"index"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// PendingReceipt is a delivery receipt received before the submit response with its delivery id
+type PendingReceipt struct {
+	Id        uint32 `storm:"id,increment"`
+	DeliverId string `storm:"index"`
+	Status    string
+	ErrorCode string
+	DoneAt    time.Time
+	CreatedAt time.Time `storm:"index"`
+}
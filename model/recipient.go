@@ -4,9 +4,14 @@ import "time"
 
 const (
 	//custom statuses
-	NEW         string = "NEW"
+	SCHEDULED   string = "SCHEDULED"
+	NEW                = "NEW"
 	SUBMIT_OK          = "SM_OK"
 	SUBMIT_FAIL        = "SM_FAIL"
+	//transient submit failure followed by resubmit, recorded in status history only
+	SUBMIT_RETRY = "SM_RETRY"
+	//message cancelled before delivery
+	CANCELED = "CANCELED"
 
 	//delivery receipt statuses
 	DELIVRD  = "DELIVRD"
@@ -24,6 +29,11 @@ type Recipient struct {
 	MessageId uint32 `storm:"index"`
 	Phone     string `storm:"index"`
 	Status    string
-	DeliverId string    `storm:"index"`
+	DeliverId string `storm:"index"`
+	Route     string
+	//ErrorCode is the network error code from the delivery receipt
+	ErrorCode string
+	//DoneAt is the done date from the delivery receipt
+	DoneAt    time.Time
 	CreatedAt time.Time `storm:"index"`
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Schedule is a message to be sent to its recipients later
+type Schedule struct {
+	Id        uint32    `storm:"id,increment"`
+	MessageId uint32    `storm:"unique"`
+	SendAt    time.Time `storm:"index"`
+	//ExpiresAt is zero if the message does not expire
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
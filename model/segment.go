@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Segment is a part of a multipart message sent to a recipient,
+// single part messages have one segment as well
+type Segment struct {
+	Id          uint32 `storm:"id,increment"`
+	RecipientId uint32 `storm:"index"`
+	PartNo      int
+	PartsCount  int
+	Status      string
+	DeliverId   string `storm:"index"`
+	ErrorCode   string
+	DoneAt      time.Time
+	CreatedAt   time.Time `storm:"index"`
+}
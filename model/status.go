@@ -0,0 +1,47 @@
+package model
+
+import "fmt"
+
+// statusStages orders statuses of a message on its way to the recipient,
+// statuses not listed here (DELIVRD, UNDELIV, EXPIRED etc.) are final
+var statusStages = map[string]int{
+	SCHEDULED: 0,
+	//records saved without status
+	"":          1,
+	NEW:         1,
+	SUBMIT_OK:   2,
+	SUBMIT_FAIL: 2,
+	ENROUTE:     3,
+	ACCEPTD:     4,
+}
+
+const finalStage = 5
+
+// StatusStage returns position of the status in SCHEDULED -> NEW -> SM_OK/SM_FAIL -> ENROUTE -> ACCEPTD -> final
+func StatusStage(status string) int {
+	if stage, ok := statusStages[status]; ok {
+		return stage
+	}
+	return finalStage
+}
+
+// IsFinal reports whether the status can not change anymore
+func IsFinal(status string) bool {
+	return StatusStage(status) == finalStage
+}
+
+// CanChangeStatus reports whether status may change from {from} to {to},
+// only moves to later stages are allowed so that late or reordered responses can not regress the status
+func CanChangeStatus(from, to string) bool {
+	return StatusStage(to) > StatusStage(from)
+}
+
+// IgnoredTransitionErr is returned when a status update is rejected by the state machine
+type IgnoredTransitionErr struct {
+	From string
+	To   string
+}
+
+func (e IgnoredTransitionErr) Error() string {
+	return fmt.Sprintf("ignored status transition %s -> %s", e.From, e.To)
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// StatusEvent is a submit response or delivery receipt received for a recipient
+type StatusEvent struct {
+	Id          uint32 `storm:"id,increment"`
+	RecipientId uint32 `storm:"index"`
+	//PartNo is the number of the submitted part, 0 for receipts and failures of the whole message
+	PartNo    int
+	Status    string
+	SmscId    string
+	ErrorCode string
+	//Ignored is set if the event did not change status of the recipient
+	Ignored   bool
+	CreatedAt time.Time `storm:"index"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanChangeStatus(t *testing.T) {
+	require.True(t, CanChangeStatus(SCHEDULED, NEW))
+	require.True(t, CanChangeStatus(SCHEDULED, CANCELED))
+	require.False(t, CanChangeStatus(NEW, SCHEDULED))
+	require.False(t, CanChangeStatus(CANCELED, NEW))
+	require.True(t, CanChangeStatus(NEW, SUBMIT_OK))
+	require.True(t, CanChangeStatus(NEW, SUBMIT_FAIL))
+	//receipt may come before submit response
+	require.True(t, CanChangeStatus(NEW, DELIVRD))
+	require.True(t, CanChangeStatus(SUBMIT_OK, ENROUTE))
+	require.True(t, CanChangeStatus(ENROUTE, ACCEPTD))
+	require.True(t, CanChangeStatus(ACCEPTD, UNDELIV))
+	require.True(t, CanChangeStatus(SUBMIT_OK, "REJECTD"))
+
+	//late submit response
+	require.False(t, CanChangeStatus(DELIVRD, SUBMIT_OK))
+	//intermediate receipt after the final one
+	require.False(t, CanChangeStatus(DELIVRD, ENROUTE))
+	require.False(t, CanChangeStatus(ACCEPTD, ENROUTE))
+	require.False(t, CanChangeStatus(SUBMIT_FAIL, SUBMIT_OK))
+	require.False(t, CanChangeStatus(UNDELIV, DELIVRD))
+	require.False(t, CanChangeStatus(SUBMIT_OK, SUBMIT_OK))
+}
+
+func TestIsFinal(t *testing.T) {
+	require.True(t, IsFinal(DELIVRD))
+	require.True(t, IsFinal(EXPIRED))
+	require.False(t, IsFinal(ENROUTE))
+	require.False(t, IsFinal(NEW))
+	require.False(t, IsFinal(SCHEDULED))
+	require.True(t, IsFinal(CANCELED))
+}
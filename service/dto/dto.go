@@ -1,5 +1,17 @@
 package dto
 
+import "time"
+
+const (
+	//types of message
+	TYPE_TEXT   = "text"
+	TYPE_BINARY = "binary"
+
+	//encodings of binary message payload
+	ENCODING_HEX    = "hex"
+	ENCODING_BASE64 = "base64"
+)
+
 type Id struct {
 	Id uint32 `json:"id"`
 }
@@ -8,6 +20,29 @@ type Message struct {
 	Sender string   `json:"sender"`
 	Text   string   `json:"text"`
 	Phones []string `json:"phones"`
+	//SendAt is the time to send the message at, it is sent immediately if omitted
+	SendAt *time.Time `json:"send_at,omitempty"`
+	//ExpiresAt is the time after which the scheduled message is not sent anymore, allowed only with SendAt
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	//ValidityPeriod is the time after which SMSC stops delivery attempts
+	ValidityPeriod *time.Time `json:"validity_period,omitempty"`
+	//DeliverAt is the time SMSC delivers the submitted message at
+	DeliverAt *time.Time `json:"deliver_at,omitempty"`
+	//Priority is priority_flag of submit_sm from 0 to 3
+	Priority int `json:"priority,omitempty"`
+	//ProtocolId is protocol_id of submit_sm from 0 to 255
+	ProtocolId int `json:"protocol_id,omitempty"`
+	//ReplaceIfPresent makes SMSC replace undelivered message from the same sender, single part messages only
+	ReplaceIfPresent bool `json:"replace_if_present,omitempty"`
+	//Class is "flash" for class 0 messages, "silent" for type 0 messages or empty for normal messages
+	Class string `json:"class,omitempty"`
+	//Type is "binary" for 8-bit data messages carrying payload in the text, "text" by default
+	Type string `json:"type,omitempty"`
+	//Encoding of binary payload is "hex" (default) or "base64"
+	Encoding string `json:"encoding,omitempty"`
+	//SourcePort and DestinationPort address an application on the handset, binary messages only
+	SourcePort      int `json:"source_port,omitempty"`
+	DestinationPort int `json:"destination_port,omitempty"`
 }
 
 type MessageStatus struct {
@@ -18,6 +53,54 @@ type MessageStatus struct {
 }
 
 type RecipientStatus struct {
-	Phone  string `json:"phone"`
+	Phone     string     `json:"phone"`
+	Status    string     `json:"status"`
+	Route     string     `json:"route,omitempty"`
+	ErrorCode string     `json:"error_code,omitempty"`
+	DoneAt    *time.Time `json:"done_at,omitempty"`
+	//History, SubmitLatencyMs and DeliveryLatencyMs are returned on request
+	History []StatusEvent `json:"history,omitempty"`
+	//SubmitLatencyMs is time from acceptance of the message, or from its send_at if scheduled, till submit of its last part
+	SubmitLatencyMs int64 `json:"submit_latency_ms,omitempty"`
+	//DeliveryLatencyMs is time from submit till the final delivery receipt
+	DeliveryLatencyMs int64 `json:"delivery_latency_ms,omitempty"`
+}
+
+type StatusEvent struct {
+	Status    string    `json:"status"`
+	PartNo    int       `json:"part_no,omitempty"`
+	SmscId    string    `json:"smsc_id,omitempty"`
+	ErrorCode string    `json:"error_code,omitempty"`
+	Ignored   bool      `json:"ignored,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Replacement is the new text of a message
+type Replacement struct {
+	Text string `json:"text"`
+}
+
+// OperationResult is the outcome of cancellation or replacement of a message for each of its recipients
+type OperationResult struct {
+	Id         uint32            `json:"id"`
+	Recipients []RecipientResult `json:"recipients"`
+}
+
+type RecipientResult struct {
+	Phone string `json:"phone"`
+	//Status is the status of the recipient after the operation
 	Status string `json:"status"`
+	Ok     bool   `json:"ok"`
+	//Error tells why the operation failed for the recipient
+	Error string `json:"error,omitempty"`
+}
+
+type InboundMessage struct {
+	Id          uint32    `json:"id"`
+	Phone       string    `json:"phone"`
+	Destination string    `json:"destination"`
+	Text        string    `json:"text"`
+	Route       string    `json:"route,omitempty"`
+	Partial     bool      `json:"partial,omitempty"`
+	ReceivedAt  time.Time `json:"received_at"`
 }
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/dilshat/sms-sender/service/dto"
+	"go.uber.org/zap"
+)
+
+var (
+	errFinalStatus  = errors.New("Message is already in final status")
+	errSubmitting   = errors.New("Message is being submitted, try again later")
+	errNotSubmitted = errors.New("Message is not submitted")
+	errMultipart    = errors.New("Multipart messages cannot be replaced")
+	errScheduled    = errors.New("Text of a scheduled message can be replaced for all phones only")
+	errPartReplaced = errors.New("Text of a scheduled message is kept as it is not replaced for all phones")
+)
+
+func (s service) CancelMessage(id uint32, phone string) (dto.OperationResult, error) {
+	msg, recipients, err := s.operationTargets(id, phone)
+	if err != nil {
+		return dto.OperationResult{}, err
+	}
+
+	if phone == "" {
+		//the whole message is not sent by scheduler anymore
+		err = s.scheduleDao.RemoveByMessageId(msg.Id)
+		if err != nil && err.Error() != "not found" {
+			return dto.OperationResult{}, err
+		}
+	}
+
+	result := dto.OperationResult{Id: msg.Id, Recipients: []dto.RecipientResult{}}
+	for _, recipient := range recipients {
+		err := s.cancelRecipient(msg, recipient)
+		result.Recipients = append(result.Recipients, toRecipientResult(recipient, model.CANCELED, err))
+	}
+
+	return result, nil
+}
+
+func (s service) ReplaceMessage(id uint32, phone, text string) (dto.OperationResult, error) {
+	if strings.TrimSpace(text) == "" {
+		return dto.OperationResult{}, NewInvalidPayloadError("Invalid text")
+	}
+	if len([]rune(text)) > s.messageMaxLen {
+		return dto.OperationResult{}, NewInvalidPayloadError("Message too long. Must be <= " + strconv.Itoa(s.messageMaxLen) + " symbols in length")
+	}
+
+	msg, recipients, err := s.operationTargets(id, phone)
+	if err != nil {
+		return dto.OperationResult{}, err
+	}
+	if msg.Options.Binary {
+		return dto.OperationResult{}, NewInvalidPayloadError("Binary messages cannot be replaced")
+	}
+
+	errs := make([]error, len(recipients))
+	replacedAll := true
+	for i, recipient := range recipients {
+		errs[i] = s.replaceRecipient(msg, recipient, text, phone == "")
+		replacedAll = replacedAll && errs[i] == nil
+	}
+
+	//scheduled recipients are sent the text of the message, it is stored only if it is what every recipient gets
+	if phone == "" {
+		if replacedAll {
+			err = s.messageDao.UpdateText(msg.Id, text)
+			if err != nil {
+				return dto.OperationResult{}, err
+			}
+		} else {
+			for i, recipient := range recipients {
+				if recipient.Status == model.SCHEDULED && errs[i] == nil {
+					errs[i] = errPartReplaced
+				}
+			}
+		}
+	}
+
+	result := dto.OperationResult{Id: msg.Id, Recipients: []dto.RecipientResult{}}
+	for i, recipient := range recipients {
+		result.Recipients = append(result.Recipients, toRecipientResult(recipient, recipient.Status, errs[i]))
+	}
+
+	return result, nil
+}
+
+// operationTargets returns the message with all its recipients or only the recipient with the phone
+func (s service) operationTargets(id uint32, phone string) (model.Message, []model.Recipient, error) {
+	msg, err := s.messageDao.GetOneById(id)
+	if err != nil {
+		return msg, nil, err
+	}
+
+	if phone == "" {
+		recipients, err := s.recipientDao.GetAllByMessageId(msg.Id)
+		return msg, recipients, err
+	}
+
+	recipient, err := s.recipientDao.GetOneByMessageIdAndPhone(msg.Id, phone)
+	if err != nil {
+		return msg, nil, err
+	}
+	return msg, []model.Recipient{recipient}, nil
+}
+
+// cancelRecipient removes the message from the outgoing queue or cancels its submitted parts at SMSC
+func (s service) cancelRecipient(msg model.Message, recipient model.Recipient) error {
+	if model.IsFinal(recipient.Status) {
+		return errFinalStatus
+	}
+
+	switch recipient.Status {
+	case model.SCHEDULED:
+		//scheduler skips cancelled recipients
+	case model.NEW, "":
+		dequeued, err := s.sender.Dequeue(recipient.Id)
+		if err != nil {
+			return err
+		}
+		if !dequeued {
+			return errSubmitting
+		}
+	default:
+		segments, err := s.segmentDao.GetAllByRecipientId(recipient.Id)
+		if err != nil {
+			return err
+		}
+		for _, part := range unfinishedParts(recipient, segments) {
+			err = s.sender.Cancel(recipient.Route, msg.Sender, recipient.Phone, part.DeliverId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, _, err := s.recipientDao.UpdateStatus(recipient.Id, model.CANCELED, "", time.Time{})
+	s.recordEvent(recipient.Id, 0, model.CANCELED, "", "", err)
+	return err
+}
+
+// replaceRecipient replaces text of the queued message or of the message submitted to SMSC
+func (s service) replaceRecipient(msg model.Message, recipient model.Recipient, text string, allPhones bool) error {
+	if model.IsFinal(recipient.Status) {
+		return errFinalStatus
+	}
+
+	switch recipient.Status {
+	case model.SCHEDULED:
+		if !allPhones {
+			return errScheduled
+		}
+		return nil
+	case model.NEW, "":
+		replaced, err := s.sender.ReplaceQueued(recipient.Id, text)
+		if err != nil {
+			return err
+		}
+		if !replaced {
+			return errSubmitting
+		}
+		return nil
+	}
+
+	segments, err := s.segmentDao.GetAllByRecipientId(recipient.Id)
+	if err != nil {
+		return err
+	}
+	if len(segments) > 1 {
+		return errMultipart
+	}
+	parts := unfinishedParts(recipient, segments)
+	if len(parts) == 0 {
+		return errNotSubmitted
+	}
+
+	return s.sender.Replace(recipient.Route, msg.Sender, parts[0].DeliverId, msg.Text, text)
+}
+
+// unfinishedParts returns parts submitted to the recipient which have not reached a final status yet
+func unfinishedParts(recipient model.Recipient, segments []model.Segment) []model.Segment {
+	//recipients created before parts were tracked keep delivery id of the single part
+	if len(segments) == 0 && recipient.DeliverId != "" {
+		return []model.Segment{{RecipientId: recipient.Id, PartNo: 1, PartsCount: 1, Status: recipient.Status, DeliverId: recipient.DeliverId, CreatedAt: recipient.CreatedAt}}
+	}
+
+	var parts []model.Segment
+	for _, segment := range segments {
+		if segment.DeliverId != "" && !model.IsFinal(segment.Status) {
+			parts = append(parts, segment)
+		}
+	}
+	return parts
+}
+
+func toRecipientResult(recipient model.Recipient, status string, err error) dto.RecipientResult {
+	if err != nil {
+		zap.L().Info("Operation failed for recipient", zap.Uint32("recipient-id", recipient.Id), zap.Error(err))
+		return dto.RecipientResult{Phone: recipient.Phone, Status: recipient.Status, Error: err.Error()}
+	}
+	return dto.RecipientResult{Phone: recipient.Phone, Status: status, Ok: true}
+}
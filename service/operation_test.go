@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/stretchr/testify/require"
+)
+
+const PHONE3 = "996ZZZ000001"
+
+var operationRecipients = []model.Recipient{
+	{Id: 1, MessageId: ID, Phone: PHONE, Status: model.SCHEDULED},
+	{Id: 2, MessageId: ID, Phone: PHONE2, Status: model.NEW},
+	{Id: 3, MessageId: ID, Phone: PHONE3, Status: model.SUBMIT_OK, Route: "default"},
+	{Id: 4, MessageId: ID, Phone: "996ZZZ000002", Status: model.DELIVRD},
+}
+
+func TestService_CancelMessage(t *testing.T) {
+	impl := &service{
+		sender:       mockSender{queued: true},
+		messageDao:   mockMessageDao{},
+		recipientDao: mockRecipientDao{recipients: operationRecipients},
+		segmentDao:   mockSegmentDao{},
+		eventDao:     mockStatusEventDao{},
+		scheduleDao:  mockScheduleDao{},
+	}
+	cancelCount = 0
+
+	result, err := impl.CancelMessage(ID, "")
+
+	require.NoError(t, err)
+	require.Equal(t, ID, result.Id)
+	require.Len(t, result.Recipients, 4)
+	for _, recipient := range result.Recipients[:3] {
+		require.True(t, recipient.Ok)
+		require.Equal(t, model.CANCELED, recipient.Status)
+	}
+	//only the unfinished part is cancelled at SMSC
+	require.Equal(t, 1, cancelCount)
+	require.False(t, result.Recipients[3].Ok)
+	require.Equal(t, model.DELIVRD, result.Recipients[3].Status)
+	require.NotEmpty(t, result.Recipients[3].Error)
+
+	//message is taken from the queue for submit, SMSC refuses to cancel
+	impl.sender = mockSender{err: errors.New("Cancel SM Failed")}
+
+	result, err = impl.CancelMessage(ID, "")
+
+	require.NoError(t, err)
+	require.True(t, result.Recipients[0].Ok)
+	require.False(t, result.Recipients[1].Ok)
+	require.Equal(t, model.NEW, result.Recipients[1].Status)
+	require.False(t, result.Recipients[2].Ok)
+	require.Equal(t, "Cancel SM Failed", result.Recipients[2].Error)
+
+	//single phone
+	result, err = impl.CancelMessage(ID, PHONE)
+
+	require.NoError(t, err)
+	require.Len(t, result.Recipients, 1)
+	require.Equal(t, PHONE, result.Recipients[0].Phone)
+
+	_, err = impl.CancelMessage(ID, "996ZZZ000009")
+
+	require.Error(t, err)
+}
+
+func TestService_ReplaceMessage(t *testing.T) {
+	impl := &service{
+		sender:        mockSender{queued: true},
+		messageDao:    mockMessageDao{},
+		recipientDao:  mockRecipientDao{recipients: operationRecipients},
+		segmentDao:    mockSegmentDao{},
+		messageMaxLen: MSG_MAX_LEN,
+	}
+	messageTextUpdated = false
+
+	result, err := impl.ReplaceMessage(ID, "", "new text")
+
+	require.NoError(t, err)
+	//not replaced for every phone, scheduled text is kept
+	require.False(t, result.Recipients[0].Ok)
+	require.Equal(t, model.SCHEDULED, result.Recipients[0].Status)
+	require.True(t, result.Recipients[1].Ok)
+	require.Equal(t, "new text", replacedText)
+	//multipart message
+	require.False(t, result.Recipients[2].Ok)
+	require.False(t, result.Recipients[3].Ok)
+	require.False(t, messageTextUpdated)
+
+	impl.recipientDao = mockRecipientDao{recipients: operationRecipients[:2]}
+
+	result, err = impl.ReplaceMessage(ID, "", "new text")
+
+	require.NoError(t, err)
+	require.True(t, result.Recipients[0].Ok)
+	require.True(t, result.Recipients[1].Ok)
+	require.True(t, messageTextUpdated)
+
+	impl.recipientDao = mockRecipientDao{recipients: operationRecipients}
+
+	impl.segmentDao = mockSegmentDao{single: true}
+	replacedText = ""
+	messageTextUpdated = false
+
+	result, err = impl.ReplaceMessage(ID, PHONE3, "newer text")
+
+	require.NoError(t, err)
+	require.True(t, result.Recipients[0].Ok)
+	require.Equal(t, model.SUBMIT_OK, result.Recipients[0].Status)
+	require.Equal(t, "newer text", replacedText)
+	require.False(t, messageTextUpdated)
+
+	//scheduled text is common for all phones
+	result, err = impl.ReplaceMessage(ID, PHONE, "newer text")
+
+	require.NoError(t, err)
+	require.False(t, result.Recipients[0].Ok)
+
+	_, err = impl.ReplaceMessage(ID, "", " ")
+
+	require.IsType(t, &InvalidPayloadErr{}, err)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/dilshat/sms-sender/sms"
+	"go.uber.org/zap"
+)
+
+// statuses of submitted messages awaiting delivery receipt
+var awaitingReceipt = []string{model.SUBMIT_OK, model.ENROUTE, model.ACCEPTD}
+
+// RunStatusPoller queries state of parts left without final receipt for statusQueryDelay since submit
+// and marks them UNKNOWN once statusDeadline passes; zero delay disables querying, zero deadline disables marking
+func (s service) RunStatusPoller() {
+	if s.statusQueryDelay <= 0 && s.statusDeadline <= 0 {
+		return
+	}
+
+	//every part is queried at most once per delay
+	interval := s.statusQueryDelay
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	for {
+		time.Sleep(interval)
+		s.pollStatuses(time.Now())
+	}
+}
+
+func (s service) pollStatuses(now time.Time) {
+	recipients, err := s.awaitingRecipients()
+	if err != nil {
+		zap.L().Error("Error reading recipients awaiting receipts", zap.Error(err))
+		return
+	}
+
+	//routes are polled in parallel so that a slow SMSC does not hold up queries to the others
+	routes := make(map[string][]model.Recipient)
+	for _, recipient := range recipients {
+		routes[recipient.Route] = append(routes[recipient.Route], recipient)
+	}
+	var wg sync.WaitGroup
+	for _, routeRecipients := range routes {
+		wg.Add(1)
+		go func(recipients []model.Recipient) {
+			defer wg.Done()
+			s.pollRoute(recipients, now)
+		}(routeRecipients)
+	}
+	wg.Wait()
+}
+
+// awaitingRecipients returns recipients with parts awaiting receipt, a multipart recipient is selected
+// by statuses of its parts as its aggregate status may stay NEW or SM_FAIL while some parts are submitted
+func (s service) awaitingRecipients() ([]model.Recipient, error) {
+	//recipients created before parts were tracked have no segments
+	recipients, err := s.recipientDao.GetAllByStatus(awaitingReceipt...)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[uint32]bool)
+	for _, recipient := range recipients {
+		selected[recipient.Id] = true
+	}
+
+	segments, err := s.segmentDao.GetAllByStatus(awaitingReceipt...)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if selected[segment.RecipientId] {
+			continue
+		}
+		selected[segment.RecipientId] = true
+
+		recipient, err := s.recipientDao.GetOneById(segment.RecipientId)
+		if err != nil {
+			zap.L().Error("Error reading recipient", zap.Uint32("recipient-id", segment.RecipientId), zap.Error(err))
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// pollRoute polls recipients submitted via the same route one by one
+func (s service) pollRoute(recipients []model.Recipient, now time.Time) {
+	senders := make(map[uint32]string)
+	for _, recipient := range recipients {
+		sender, ok := senders[recipient.MessageId]
+		if !ok {
+			msg, err := s.messageDao.GetOneById(recipient.MessageId)
+			if err != nil {
+				zap.L().Error("Error reading message", zap.Uint32("message-id", recipient.MessageId), zap.Error(err))
+				continue
+			}
+			sender = msg.Sender
+			senders[recipient.MessageId] = sender
+		}
+
+		s.pollRecipient(recipient, sender, now)
+	}
+}
+
+func (s service) pollRecipient(recipient model.Recipient, sender string, now time.Time) {
+	segments, err := s.segmentDao.GetAllByRecipientId(recipient.Id)
+	if err != nil {
+		zap.L().Error("Error reading segments", zap.Uint32("recipient-id", recipient.Id), zap.Error(err))
+		return
+	}
+
+	for _, part := range unfinishedParts(recipient, segments) {
+		age := now.Sub(part.CreatedAt)
+
+		var receipt sms.Receipt
+		switch {
+		case s.statusDeadline > 0 && age >= s.statusDeadline:
+			receipt = sms.Receipt{SmscId: part.DeliverId, Status: model.UNKNOWN}
+		case s.statusQueryDelay > 0 && age >= s.statusQueryDelay:
+			receipt, err = s.sender.Query(recipient.Route, sender, part.DeliverId)
+			if err != nil {
+				zap.L().Warn("Error querying message state", zap.Uint32("recipient-id", recipient.Id), zap.String("smsc-id", part.DeliverId), zap.Error(err))
+				continue
+			}
+			//SMSC may report the id in another format
+			receipt.SmscId = part.DeliverId
+			if !model.CanChangeStatus(part.Status, receipt.Status) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		zap.L().Info("Applying polled message state", zap.Uint32("recipient-id", recipient.Id), zap.String("smsc-id", part.DeliverId), zap.String("status", receipt.Status))
+		s.HandleDeliverSm(receipt)
+	}
+}
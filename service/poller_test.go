@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_pollStatuses(t *testing.T) {
+	impl := &service{
+		sender:       mockSender{state: model.DELIVRD},
+		messageDao:   mockMessageDao{},
+		recipientDao: mockRecipientDao{recipients: []model.Recipient{{Id: 3, MessageId: ID, Phone: PHONE, Status: model.SUBMIT_OK}}},
+		segmentDao:   mockSegmentDao{single: true},
+		receiptDao:   mockPendingReceiptDao{},
+		eventDao:     mockStatusEventDao{},
+		receiptMu:    &sync.Mutex{},
+	}
+	polledStatus = ""
+
+	//disabled
+	impl.pollStatuses(time.Now())
+
+	require.Empty(t, polledStatus)
+
+	//state is queried after delay
+	impl.statusQueryDelay = time.Minute
+
+	impl.pollStatuses(time.Now())
+
+	require.Equal(t, model.DELIVRD, polledStatus)
+
+	//query fails
+	impl.sender = mockSender{err: errors.New("No response from SMSC")}
+	polledStatus = ""
+
+	impl.pollStatuses(time.Now())
+
+	require.Empty(t, polledStatus)
+
+	//part is marked unknown after deadline
+	impl.statusDeadline = time.Hour
+
+	impl.pollStatuses(time.Now())
+
+	require.Equal(t, model.UNKNOWN, polledStatus)
+
+	//multipart recipient failed to submit some parts
+	impl.recipientDao = mockRecipientDao{recipients: []model.Recipient{{Id: 5, MessageId: ID, Phone: PHONE, Status: model.SUBMIT_FAIL}}}
+	impl.segmentDao = mockSegmentDao{awaiting: []model.Segment{{Id: 1, RecipientId: 5, PartNo: 1, PartsCount: 2, Status: model.SUBMIT_OK, DeliverId: "321"}}}
+	polledStatus = ""
+
+	impl.pollStatuses(time.Now())
+
+	require.Equal(t, model.UNKNOWN, polledStatus)
+}
+
+func TestService_pollRecipient(t *testing.T) {
+	impl := &service{
+		sender:           mockSender{state: model.ENROUTE},
+		recipientDao:     mockRecipientDao{},
+		segmentDao:       mockSegmentDao{single: true},
+		receiptDao:       mockPendingReceiptDao{},
+		eventDao:         mockStatusEventDao{},
+		statusQueryDelay: time.Minute,
+		statusDeadline:   time.Hour,
+		receiptMu:        &sync.Mutex{},
+	}
+	polledStatus = ""
+	recipient := model.Recipient{Id: 3, MessageId: ID, Phone: PHONE, Status: model.SUBMIT_OK}
+
+	//part submitted just now
+	impl.pollRecipient(recipient, SENDER, time.Time{})
+
+	require.Empty(t, polledStatus)
+
+	impl.pollRecipient(recipient, SENDER, time.Time{}.Add(time.Minute))
+
+	require.Equal(t, model.ENROUTE, polledStatus)
+}
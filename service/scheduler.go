@@ -0,0 +1,115 @@
+package service
+
+import (
+	"time"
+
+	"github.com/dilshat/sms-sender/model"
+	"go.uber.org/zap"
+)
+
+// interval between checks for due scheduled messages
+const schedulerInterval = time.Second
+
+// RunScheduler hands scheduled messages to sender when they are due,
+// schedules are persisted so messages due during downtime are sent after restart
+func (s service) RunScheduler() {
+	for {
+		s.sendDue(time.Now())
+		time.Sleep(schedulerInterval)
+	}
+}
+
+func (s service) sendDue(now time.Time) {
+	schedules, err := s.scheduleDao.GetDue(now)
+	if err != nil {
+		zap.L().Error("Error reading scheduled messages", zap.Error(err))
+		return
+	}
+
+	for _, schedule := range schedules {
+		//the schedule is removed only after its recipients leave SCHEDULED, so a restart meanwhile
+		//does not lose them; recipients already sent or cancelled are skipped by their status
+		err = s.sendScheduled(schedule, now)
+		if err != nil {
+			continue
+		}
+
+		err = s.scheduleDao.RemoveByMessageId(schedule.MessageId)
+		if err != nil && err.Error() != "not found" {
+			zap.L().Error("Error removing schedule", zap.Uint32("message-id", schedule.MessageId), zap.Error(err))
+		}
+	}
+}
+
+// sendScheduled sends the message to recipients still SCHEDULED and to NEW ones lost by a crash
+// before they were queued, error means the message is to be retried
+func (s service) sendScheduled(schedule model.Schedule, now time.Time) error {
+	msg, err := s.messageDao.GetOneById(schedule.MessageId)
+	if err != nil {
+		zap.L().Error("Error reading scheduled message", zap.Uint32("message-id", schedule.MessageId), zap.Error(err))
+		return err
+	}
+	recipients, err := s.recipientDao.GetAllByMessageId(msg.Id)
+	if err != nil {
+		zap.L().Error("Error reading recipients of scheduled message", zap.Uint32("message-id", msg.Id), zap.Error(err))
+		return err
+	}
+
+	expired := !schedule.ExpiresAt.IsZero() && !now.Before(schedule.ExpiresAt)
+	var failed error
+	for _, recipient := range recipients {
+		switch recipient.Status {
+		case model.SCHEDULED:
+			if expired {
+				_, _, err = s.recipientDao.UpdateStatus(recipient.Id, model.EXPIRED, "", time.Time{})
+				s.recordEvent(recipient.Id, 0, model.EXPIRED, "", "", err)
+				continue
+			}
+
+			_, _, err = s.recipientDao.UpdateStatus(recipient.Id, model.NEW, "", time.Time{})
+			s.recordEvent(recipient.Id, 0, model.NEW, "", "", err)
+			if err != nil {
+				zap.L().Error("Error updating status of scheduled recipient", zap.Uint32("recipient-id", recipient.Id), zap.Error(err))
+				failed = err
+				continue
+			}
+		case model.NEW:
+			lost, err := s.lostBeforeQueued(recipient.Id)
+			if err != nil {
+				zap.L().Error("Error checking scheduled recipient", zap.Uint32("recipient-id", recipient.Id), zap.Error(err))
+				failed = err
+				continue
+			}
+			if !lost {
+				continue
+			}
+		default:
+			continue
+		}
+
+		err = s.sender.Send(recipient.Id, msg.Sender, recipient.Phone, msg.Text, msg.Options)
+		if err != nil {
+			zap.L().Error("Error sending scheduled message", zap.Uint32("recipient-id", recipient.Id), zap.Error(err))
+			err = s.recipientDao.UpdateSubmitStatus(recipient.Id, "", model.SUBMIT_FAIL, "")
+			s.recordEvent(recipient.Id, 0, model.SUBMIT_FAIL, "", "", err)
+		}
+	}
+
+	return failed
+}
+
+// lostBeforeQueued reports whether the NEW recipient is neither queued nor has any part submitted,
+// that is the scheduler stopped between updating its status and handing it to sender
+func (s service) lostBeforeQueued(recipientId uint32) (bool, error) {
+	queued, err := s.sender.Queued(recipientId)
+	if err != nil || queued {
+		return false, err
+	}
+
+	segments, err := s.segmentDao.GetAllByRecipientId(recipientId)
+	if err != nil {
+		return false, err
+	}
+
+	return len(segments) == 0, nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dilshat/sms-sender/model"
+	"github.com/dilshat/sms-sender/service/dto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_SendMessageScheduled(t *testing.T) {
+	impl := &service{
+		sender:          mockSender{},
+		messageDao:      mockMessageDao{},
+		recipientDao:    mockRecipientDao{},
+		scheduleDao:     mockScheduleDao{},
+		statusStoreDays: STATUS_STORE_DAYS,
+		messageMaxLen:   MSG_MAX_LEN,
+		phoneRx:         regexp.MustCompile(PHONE_MASK),
+	}
+	sendAt := time.Now().Add(time.Hour)
+	expiresAt := sendAt.Add(time.Hour)
+	sentCount = 0
+	scheduleCreated = false
+
+	id, err := impl.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, SendAt: &sendAt, ExpiresAt: &expiresAt})
+
+	require.NoError(t, err)
+	require.True(t, id.Id > 0)
+	require.True(t, scheduleCreated)
+	require.Equal(t, model.SCHEDULED, createdStatus)
+	require.Equal(t, 0, sentCount)
+
+	//expiry before send time
+	_, err = impl.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, SendAt: &expiresAt, ExpiresAt: &sendAt})
+
+	require.Error(t, err)
+
+	//expiry of a message sent immediately
+	_, err = impl.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, ExpiresAt: &expiresAt})
+
+	require.Error(t, err)
+
+	//send time beyond storage period
+	tooLate := time.Now().Add(24 * time.Hour * time.Duration(STATUS_STORE_DAYS+1))
+	_, err = impl.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, SendAt: &tooLate})
+
+	require.Error(t, err)
+}
+
+func TestService_sendDue(t *testing.T) {
+	now := time.Now()
+	impl := &service{
+		sender:       mockSender{},
+		messageDao:   mockMessageDao{},
+		recipientDao: mockRecipientDao{scheduled: true},
+		eventDao:     mockStatusEventDao{},
+		scheduleDao:  mockScheduleDao{due: []model.Schedule{{Id: 1, MessageId: ID, SendAt: now}}},
+	}
+	sentCount = 0
+	scheduleRemoved = false
+
+	impl.sendDue(now)
+
+	require.Equal(t, 2, sentCount)
+	require.Equal(t, model.NEW, updatedStatus)
+	require.True(t, scheduleRemoved)
+
+	//expired message is not sent
+	impl.scheduleDao = mockScheduleDao{due: []model.Schedule{{Id: 1, MessageId: ID, SendAt: now.Add(-time.Hour), ExpiresAt: now}}}
+	sentCount = 0
+
+	impl.sendDue(now)
+
+	require.Equal(t, 0, sentCount)
+	require.Equal(t, model.EXPIRED, updatedStatus)
+
+	//cancelled meanwhile
+	impl.scheduleDao = mockScheduleDao{due: []model.Schedule{{Id: 1, MessageId: ID, SendAt: now}}, removed: true}
+	impl.recipientDao = mockRecipientDao{recipients: []model.Recipient{{Id: 1, MessageId: ID, Phone: PHONE, Status: model.CANCELED}}}
+
+	impl.sendDue(now)
+
+	require.Equal(t, 0, sentCount)
+
+	//status update failed, the schedule is kept for retry
+	impl.scheduleDao = mockScheduleDao{due: []model.Schedule{{Id: 1, MessageId: ID, SendAt: now}}}
+	impl.recipientDao = mockRecipientDao{scheduled: true, updateErr: errors.New("timeout")}
+	scheduleRemoved = false
+
+	impl.sendDue(now)
+
+	require.Equal(t, 0, sentCount)
+	require.False(t, scheduleRemoved)
+
+	//recipient became NEW but was not queued before a crash
+	impl.recipientDao = mockRecipientDao{recipients: []model.Recipient{{Id: 1, MessageId: ID, Phone: PHONE, Status: model.NEW}}}
+	impl.segmentDao = mockSegmentDao{unsent: true}
+
+	impl.sendDue(now)
+
+	require.Equal(t, 1, sentCount)
+	require.True(t, scheduleRemoved)
+
+	//recipient is queued already
+	impl.sender = mockSender{queued: true}
+	sentCount = 0
+
+	impl.sendDue(now)
+
+	require.Equal(t, 0, sentCount)
+}
@@ -2,11 +2,15 @@ package service
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dilshat/sms-sender/dao"
@@ -31,36 +35,74 @@ func NewInvalidPayloadError(msg string) *InvalidPayloadErr {
 
 type Service interface {
 	SendMessage(message dto.Message) (dto.Id, error)
-	CheckStatusOfMessage(id uint32) (dto.MessageStatus, error)
-	CheckStatusOfRecipient(id uint32, phone string) (dto.MessageStatus, error)
+	//CheckStatusOfMessage returns statuses of all recipients of the message, optionally with their status history
+	CheckStatusOfMessage(id uint32, history bool) (dto.MessageStatus, error)
+	//CheckStatusOfRecipient returns status of the message sent to the phone, optionally with its status history
+	CheckStatusOfRecipient(id uint32, phone string, history bool) (dto.MessageStatus, error)
+	//CancelMessage cancels the message for all recipients or only for the phone and reports the outcome for every recipient
+	CancelMessage(id uint32, phone string) (dto.OperationResult, error)
+	//ReplaceMessage replaces text of the message for all recipients or only for the phone and reports the outcome for every recipient
+	ReplaceMessage(id uint32, phone, text string) (dto.OperationResult, error)
+	//GetInbound returns at most {limit} latest inbound messages, optionally only from the phone
+	GetInbound(phone string, limit int) ([]dto.InboundMessage, error)
 }
 type service struct {
 	sender          sms.Sender
 	messageDao      dao.MessageDao
 	recipientDao    dao.RecipientDao
+	segmentDao      dao.SegmentDao
+	inboundDao      dao.InboundDao
+	receiptDao      dao.PendingReceiptDao
+	eventDao        dao.StatusEventDao
+	scheduleDao     dao.ScheduleDao
 	httpClient      *http.Client
 	statusStoreDays int
-	messageMaxLen   int
-	webhook         string
-	phoneRx         *regexp.Regexp
+	//time to keep receipts awaiting submit response with their delivery id
+	receiptExpiry time.Duration
+	//time since submit after which state of a part without final receipt is queried with query_sm
+	statusQueryDelay time.Duration
+	//time since submit after which a part without final status is marked UNKNOWN
+	statusDeadline time.Duration
+	messageMaxLen  int
+	//max length of binary payload in bytes
+	binaryMaxLen   int
+	webhook        string
+	inboundWebhook string
+	phoneRx        *regexp.Regexp
+	//orders storing of delivery ids on submit and parking of receipts with unknown delivery ids
+	receiptMu *sync.Mutex
 }
 
-func NewService(sender sms.Sender, messageDao dao.MessageDao, recipientDao dao.RecipientDao, statusStoreDays, messageMaxLen int, webhook, phoneMask string) Service {
+func NewService(sender sms.Sender, messageDao dao.MessageDao, recipientDao dao.RecipientDao, segmentDao dao.SegmentDao, inboundDao dao.InboundDao, receiptDao dao.PendingReceiptDao, eventDao dao.StatusEventDao, scheduleDao dao.ScheduleDao, statusStoreDays, receiptExpiryMin, statusQueryDelayMin, statusDeadlineHours, messageMaxLen, binaryMaxLen int, webhook, inboundWebhook, phoneMask string) Service {
 	service := &service{
-		sender:          sender,
-		messageDao:      messageDao,
-		recipientDao:    recipientDao,
-		statusStoreDays: statusStoreDays,
-		messageMaxLen:   messageMaxLen,
-		webhook:         webhook,
-		phoneRx:         regexp.MustCompile(phoneMask),
-		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		sender:           sender,
+		messageDao:       messageDao,
+		recipientDao:     recipientDao,
+		segmentDao:       segmentDao,
+		inboundDao:       inboundDao,
+		receiptDao:       receiptDao,
+		eventDao:         eventDao,
+		scheduleDao:      scheduleDao,
+		statusStoreDays:  statusStoreDays,
+		receiptExpiry:    time.Duration(receiptExpiryMin) * time.Minute,
+		statusQueryDelay: time.Duration(statusQueryDelayMin) * time.Minute,
+		statusDeadline:   time.Duration(statusDeadlineHours) * time.Hour,
+		messageMaxLen:    messageMaxLen,
+		binaryMaxLen:     binaryMaxLen,
+		webhook:          webhook,
+		inboundWebhook:   inboundWebhook,
+		phoneRx:          regexp.MustCompile(phoneMask),
+		httpClient:       &http.Client{Timeout: 10 * time.Second},
+		receiptMu:        &sync.Mutex{},
 	}
 
 	sender.BindDeliverSmHandler(service.HandleDeliverSm)
 	sender.BindSubmitSmResponseHandler(service.HandleSubmitSmResp)
+	sender.BindInboundHandler(service.HandleInbound)
 
 	go service.CleanupDb()
+	go service.RunScheduler()
+	go service.RunStatusPoller()
 
 	return service
 }
@@ -75,70 +117,221 @@ func (s service) CleanupDb() {
 		if err != nil {
 			zap.L().Warn("Error cleaning up recipients", zap.Error(err))
 		}
+		err = s.segmentDao.RemoveOlderThanDays(s.statusStoreDays)
+		if err != nil {
+			zap.L().Warn("Error cleaning up segments", zap.Error(err))
+		}
+		err = s.inboundDao.RemoveOlderThanDays(s.statusStoreDays)
+		if err != nil {
+			zap.L().Warn("Error cleaning up inbound messages", zap.Error(err))
+		}
+		err = s.eventDao.RemoveOlderThanDays(s.statusStoreDays)
+		if err != nil {
+			zap.L().Warn("Error cleaning up status history", zap.Error(err))
+		}
+		err = s.receiptDao.RemoveOlderThan(s.receiptExpiry)
+		if err != nil {
+			zap.L().Warn("Error cleaning up pending receipts", zap.Error(err))
+		}
 		time.Sleep(time.Hour)
 	}
 }
 
-func (s service) HandleSubmitSmResp(id, status uint32, smscId string) {
+func (s service) HandleSubmitSmResp(result sms.SubmitResult) {
+	//the part is resubmitted, its final result comes later
+	if result.Retry {
+		s.recordEvent(result.Id, result.PartNo, model.SUBMIT_RETRY, "", submitErrorCode(result.Status), nil)
+		return
+	}
+
+	s.receiptMu.Lock()
+	s.updateSubmitStatus(result)
+	var receipts []model.PendingReceipt
+	if result.SmscId != "" {
+		receipts = s.takePendingReceipts(result.SmscId)
+	}
+	s.receiptMu.Unlock()
+
+	//receipts arrived before the submit response
+	for _, receipt := range receipts {
+		if time.Since(receipt.CreatedAt) > s.receiptExpiry {
+			continue
+		}
+		parked := sms.Receipt{SmscId: receipt.DeliverId, Status: receipt.Status, ErrorCode: receipt.ErrorCode, DoneDate: receipt.DoneAt}
+		recipientId, msgId, phone, err := s.updateDeliverStatus(parked)
+		s.reportDeliverStatus(parked, recipientId, msgId, phone, err)
+	}
+}
+
+func (s service) updateSubmitStatus(result sms.SubmitResult) {
 	smStatus := model.SUBMIT_OK
-	if status != 0 {
+	if result.Status != 0 {
 		smStatus = model.SUBMIT_FAIL
 	}
-	err := s.recipientDao.UpdateSubmitStatus(id, smscId, smStatus)
+
+	//message failed before any of its parts was submitted
+	if result.PartNo == 0 {
+		err := s.recipientDao.UpdateSubmitStatus(result.Id, result.SmscId, smStatus, result.Route)
+		s.recordEvent(result.Id, 0, smStatus, result.SmscId, submitErrorCode(result.Status), err)
+		if err != nil && !ignoredTransition(err, zap.Uint32("recipient-id", result.Id)) {
+			zap.L().Error("Error updating submit status", zap.Error(err))
+		}
+		return
+	}
+
+	err := s.segmentDao.UpdateSubmitStatus(result.Id, result.PartNo, result.PartsCount, result.SmscId, smStatus)
+	s.recordEvent(result.Id, result.PartNo, smStatus, result.SmscId, submitErrorCode(result.Status), err)
+	if err != nil && !ignoredTransition(err, zap.Uint32("recipient-id", result.Id), zap.Int("part-no", result.PartNo)) {
+		zap.L().Error("Error updating submit status of segment", zap.Error(err))
+		return
+	}
+
+	segments, err := s.segmentDao.GetAllByRecipientId(result.Id)
 	if err != nil {
+		zap.L().Error("Error reading segments", zap.Error(err))
+		return
+	}
+
+	err = s.recipientDao.UpdateSubmitStatus(result.Id, result.SmscId, aggregateStatus(segments), result.Route)
+	if err != nil && !ignoredTransition(err, zap.Uint32("recipient-id", result.Id)) {
 		zap.L().Error("Error updating submit status", zap.Error(err))
 	}
 }
 
-func (s service) HandleDeliverSm(smscId string, status string) {
-	msgId, phone, err := s.recipientDao.UpdateDeliverStatus(smscId, status)
-	if err != nil {
-		if err.Error() == "not found" {
-			//retry update with the id in another format
-			if util.IsDecimal(smscId) {
-				//try to update with the id in hex format
-				msgId, phone, err = s.recipientDao.UpdateDeliverStatus(util.DecimalToHexString(smscId), status)
-			} else {
-				//try to update with the id in decimal format
-				msgId, phone, err = s.recipientDao.UpdateDeliverStatus(util.HexToDecimalString(smscId), status)
-			}
+func (s service) HandleDeliverSm(receipt sms.Receipt) {
+	s.receiptMu.Lock()
+	recipientId, msgId, phone, err := s.updateDeliverStatus(receipt)
+	if err != nil && err.Error() == "not found" {
+		//submit response with the delivery id has not been handled yet
+		err = s.receiptDao.Create(receipt.SmscId, receipt.Status, receipt.ErrorCode, receipt.DoneDate)
+		s.receiptMu.Unlock()
+		if err != nil {
+			zap.L().Error("Error saving pending receipt", zap.Error(err))
+		}
+		return
+	}
+	s.receiptMu.Unlock()
+
+	s.reportDeliverStatus(receipt, recipientId, msgId, phone, err)
+}
+
+// takePendingReceipts removes and returns receipts with the delivery id in either format
+func (s service) takePendingReceipts(smscId string) []model.PendingReceipt {
+	var receipts []model.PendingReceipt
+	for _, id := range []string{smscId, alternateSmscId(smscId)} {
+		if id == "" {
+			continue
+		}
+		taken, err := s.receiptDao.TakeByDeliverId(id)
+		if err != nil {
+			zap.L().Error("Error reading pending receipts", zap.Error(err))
+			continue
+		}
+		receipts = append(receipts, taken...)
+	}
+	return receipts
+}
+
+// updateDeliverStatus updates status of the segment or recipient with the delivery id
+// and returns id, message id and phone of the recipient
+func (s service) updateDeliverStatus(receipt sms.Receipt) (recipientId, msgId uint32, phone string, err error) {
+	smscId, status := receipt.SmscId, receipt.Status
 
-			if err != nil {
-				zap.L().Error("Error updating delivery status", zap.Error(err))
-				return
+	recipientId, err = s.segmentDao.UpdateDeliverStatus(smscId, status, receipt.ErrorCode, receipt.DoneDate)
+	if err != nil && err.Error() == "not found" {
+		//retry update with the id in another format
+		recipientId, err = s.segmentDao.UpdateDeliverStatus(alternateSmscId(smscId), status, receipt.ErrorCode, receipt.DoneDate)
+	}
+
+	if err == nil {
+		var segments []model.Segment
+		segments, err = s.segmentDao.GetAllByRecipientId(recipientId)
+		if err != nil {
+			return
+		}
+		aggregated := aggregateStatus(segments)
+		errorCode, doneAt := aggregateReceipt(segments, aggregated)
+		msgId, phone, err = s.recipientDao.UpdateStatus(recipientId, aggregated, errorCode, doneAt)
+	} else if err.Error() == "not found" {
+		//recipients submitted before segments were tracked
+		msgId, phone, err = s.recipientDao.UpdateDeliverStatus(smscId, status, receipt.ErrorCode, receipt.DoneDate)
+		if err != nil && err.Error() == "not found" {
+			msgId, phone, err = s.recipientDao.UpdateDeliverStatus(alternateSmscId(smscId), status, receipt.ErrorCode, receipt.DoneDate)
+		}
+		if msgId != 0 {
+			recipient, getErr := s.recipientDao.GetOneByMessageIdAndPhone(msgId, phone)
+			if getErr == nil {
+				recipientId = recipient.Id
 			}
-		} else {
+		}
+	}
+
+	return
+}
+
+// reportDeliverStatus records the receipt in status history, logs failed update of delivery status
+// or notifies web hook about the new status
+func (s service) reportDeliverStatus(receipt sms.Receipt, recipientId, msgId uint32, phone string, err error) {
+	if recipientId != 0 {
+		s.recordEvent(recipientId, 0, receipt.Status, receipt.SmscId, receipt.ErrorCode, err)
+	}
+
+	if err != nil {
+		if !ignoredTransition(err, zap.String("smsc-id", receipt.SmscId)) {
 			zap.L().Error("Error updating delivery status", zap.Error(err))
-			return
 		}
+		return
 	}
 
 	if util.IsBlank(s.webhook) {
 		return
 	}
 
-	msgStatus, err := s.CheckStatusOfRecipient(msgId, phone)
+	msgStatus, err := s.CheckStatusOfRecipient(msgId, phone, false)
 	if err != nil {
 		zap.L().Error("Error checking recipient message status", zap.Error(err))
 		return
 	}
 
-	msgStatusBytes, err := json.Marshal(msgStatus)
+	s.callWebhook(s.webhook, msgStatus)
+}
+
+func (s service) HandleInbound(msg sms.InboundMessage) {
+	id, err := s.inboundDao.Create(msg.Source, msg.Destination, msg.Text, msg.Route, msg.Partial)
+	if err != nil {
+		zap.L().Error("Error saving inbound message", zap.Error(err))
+		return
+	}
+
+	if util.IsBlank(s.inboundWebhook) {
+		return
+	}
+
+	inbound, err := s.inboundDao.GetOneById(id)
 	if err != nil {
-		zap.L().Error("Error checking recipient message status", zap.Error(err))
+		zap.L().Error("Error reading inbound message", zap.Error(err))
 		return
 	}
 
-	client := &http.Client{Timeout: time.Second * 10}
+	s.callWebhook(s.inboundWebhook, toInboundDto(inbound))
+}
+
+// callWebhook posts payload as JSON to the url
+func (s service) callWebhook(url string, payload interface{}) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		zap.L().Error("Error marshalling web hook payload", zap.Error(err))
+		return
+	}
 
-	req, err := http.NewRequest("POST", s.webhook, bytes.NewBuffer(msgStatusBytes))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		zap.L().Error("Error calling web hook", zap.Error(err))
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		zap.L().Error("Error calling web hook", zap.Error(err))
 		return
@@ -150,6 +343,84 @@ func (s service) HandleDeliverSm(smscId string, status string) {
 	}
 }
 
+// recordEvent appends event to the status history of the recipient unless its status update failed
+func (s service) recordEvent(recipientId uint32, partNo int, status, smscId, errorCode string, updateErr error) {
+	_, ignored := updateErr.(model.IgnoredTransitionErr)
+	if updateErr != nil && !ignored {
+		return
+	}
+
+	err := s.eventDao.Create(recipientId, partNo, status, smscId, errorCode, ignored)
+	if err != nil {
+		zap.L().Error("Error saving status event", zap.Error(err))
+	}
+}
+
+// submitErrorCode formats non-zero SMPP command status of submit response
+func submitErrorCode(status uint32) string {
+	if status == 0 {
+		return ""
+	}
+	return fmt.Sprintf("0x%08X", status)
+}
+
+// ignoredTransition logs status updates rejected by the state machine,
+// they are expected when responses and receipts arrive out of order
+func ignoredTransition(err error, fields ...zap.Field) bool {
+	transitionErr, ok := err.(model.IgnoredTransitionErr)
+	if ok {
+		zap.L().Info("Ignored status transition", append(fields, zap.String("from", transitionErr.From), zap.String("to", transitionErr.To))...)
+	}
+	return ok
+}
+
+// alternateSmscId converts decimal SMSC message id to hex and vice versa,
+// SMSCs are known to use different formats in submit_sm_resp and receipts
+func alternateSmscId(smscId string) string {
+	if util.IsDecimal(smscId) {
+		return util.DecimalToHexString(smscId)
+	}
+	return util.HexToDecimalString(smscId)
+}
+
+// aggregateStatus derives status of a recipient from statuses of its segments:
+// any failed segment fails the whole message, otherwise the least advanced segment wins
+func aggregateStatus(segments []model.Segment) string {
+	if len(segments) == 0 {
+		return model.NEW
+	}
+
+	status := model.DELIVRD
+	for _, segment := range segments {
+		//failed submit or final status other than DELIVRD
+		if segment.Status == model.SUBMIT_FAIL || (model.IsFinal(segment.Status) && segment.Status != model.DELIVRD) {
+			return segment.Status
+		}
+		if model.StatusStage(segment.Status) < model.StatusStage(status) {
+			status = segment.Status
+		}
+	}
+
+	//some parts have not been responded yet
+	if len(segments) < segments[0].PartsCount {
+		return model.NEW
+	}
+
+	return status
+}
+
+// aggregateReceipt returns error code and done date of the latest segment receipt with the aggregated status
+func aggregateReceipt(segments []model.Segment, status string) (string, time.Time) {
+	var errorCode string
+	var doneAt time.Time
+	for _, segment := range segments {
+		if segment.Status == status && !segment.DoneAt.Before(doneAt) {
+			errorCode, doneAt = segment.ErrorCode, segment.DoneAt
+		}
+	}
+	return errorCode, doneAt
+}
+
 func (s service) SendMessage(message dto.Message) (dto.Id, error) {
 
 	//overall message validation
@@ -157,19 +428,61 @@ func (s service) SendMessage(message dto.Message) (dto.Id, error) {
 		return dto.Id{}, NewInvalidPayloadError("Invalid message ")
 	}
 
-	//check phone format
+	//check phone format, that some SMSC serves the phone and that the sender can be sent as source address via it
+	validated := make(map[string]bool)
 	for _, phone := range message.Phones {
 		if !s.phoneRx.MatchString(phone) {
 			return dto.Id{}, NewInvalidPayloadError("Invalid phone " + phone)
 		}
+		route, err := s.sender.Route(phone)
+		if err != nil {
+			return dto.Id{}, NewInvalidPayloadError("Invalid phone " + phone + ". " + err.Error())
+		}
+		if validated[route] {
+			continue
+		}
+		if err := s.sender.ValidateSender(route, message.Sender); err != nil {
+			return dto.Id{}, NewInvalidPayloadError("Invalid sender. " + err.Error())
+		}
+		validated[route] = true
+	}
+
+	//check payload and max length of sms, binary payload is stored hex encoded
+	text, err := s.messagePayload(message)
+	if err != nil {
+		return dto.Id{}, err
+	}
+
+	//check schedule
+	now := time.Now()
+	scheduled := message.SendAt != nil && message.SendAt.After(now)
+	if scheduled && message.SendAt.Sub(now) > 24*time.Duration(s.statusStoreDays)*time.Hour {
+		return dto.Id{}, NewInvalidPayloadError("Invalid send_at. Must be within " + strconv.Itoa(s.statusStoreDays) + " days")
+	}
+	var expiresAt time.Time
+	if message.ExpiresAt != nil {
+		//immediate messages are limited by validity_period instead
+		if !scheduled {
+			return dto.Id{}, NewInvalidPayloadError("Invalid expires_at. Allowed only with send_at in future")
+		}
+		expiresAt = *message.ExpiresAt
+		if !expiresAt.After(now) || (scheduled && !expiresAt.After(*message.SendAt)) {
+			return dto.Id{}, NewInvalidPayloadError("Invalid expires_at. Must be later than send_at")
+		}
+	}
+
+	//check submit options
+	options, err := submitOptions(message, now, scheduled)
+	if err != nil {
+		return dto.Id{}, err
 	}
 
-	//check max length of sms
-	if len([]rune(message.Text)) > s.messageMaxLen {
-		return dto.Id{}, NewInvalidPayloadError("Message too long. Must be <= " + strconv.Itoa(s.messageMaxLen) + " symbols in length")
+	initialStatus := model.NEW
+	if scheduled {
+		initialStatus = model.SCHEDULED
 	}
 
-	msgId, err := s.messageDao.Create(message.Text, message.Sender)
+	msgId, err := s.messageDao.Create(text, message.Sender, options)
 	if err != nil {
 		return dto.Id{}, err
 	}
@@ -181,12 +494,22 @@ func (s service) SendMessage(message dto.Message) (dto.Id, error) {
 	}
 
 	for phone := range uniquePhones {
-		id, err := s.recipientDao.Create(msgId, phone)
+		id, err := s.recipientDao.Create(msgId, phone, initialStatus)
 		if err != nil {
 			return dto.Id{}, err
 		}
+		if scheduled {
+			continue
+		}
+
+		err = s.sender.Send(id, message.Sender, phone, text, options)
+		if err != nil {
+			return dto.Id{}, err
+		}
+	}
 
-		err = s.sender.Send(id, message.Sender, phone, message.Text)
+	if scheduled {
+		err = s.scheduleDao.Create(msgId, *message.SendAt, expiresAt)
 		if err != nil {
 			return dto.Id{}, err
 		}
@@ -195,7 +518,95 @@ func (s service) SendMessage(message dto.Message) (dto.Id, error) {
 	return dto.Id{Id: msgId}, nil
 }
 
-func (s service) CheckStatusOfMessage(id uint32) (dto.MessageStatus, error) {
+// messagePayload returns text of the message or its binary payload hex encoded
+func (s service) messagePayload(message dto.Message) (string, error) {
+	switch message.Type {
+	case "", dto.TYPE_TEXT:
+		if len([]rune(message.Text)) > s.messageMaxLen {
+			return "", NewInvalidPayloadError("Message too long. Must be <= " + strconv.Itoa(s.messageMaxLen) + " symbols in length")
+		}
+		return message.Text, nil
+	case dto.TYPE_BINARY:
+	default:
+		return "", NewInvalidPayloadError("Invalid type. Must be " + dto.TYPE_TEXT + " or " + dto.TYPE_BINARY)
+	}
+
+	var data []byte
+	var err error
+	switch message.Encoding {
+	case "", dto.ENCODING_HEX:
+		data, err = hex.DecodeString(message.Text)
+	case dto.ENCODING_BASE64:
+		data, err = base64.StdEncoding.DecodeString(message.Text)
+	default:
+		return "", NewInvalidPayloadError("Invalid encoding. Must be " + dto.ENCODING_HEX + " or " + dto.ENCODING_BASE64)
+	}
+	if err != nil || len(data) == 0 {
+		return "", NewInvalidPayloadError("Invalid binary payload")
+	}
+	if len(data) > s.binaryMaxLen {
+		return "", NewInvalidPayloadError("Message too long. Must be <= " + strconv.Itoa(s.binaryMaxLen) + " bytes in length")
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+// submitOptions validates submit_sm parameters of the message
+func submitOptions(message dto.Message, now time.Time, scheduled bool) (model.SubmitOptions, error) {
+	options := model.SubmitOptions{
+		Priority:         message.Priority,
+		ProtocolId:       message.ProtocolId,
+		ReplaceIfPresent: message.ReplaceIfPresent,
+		Class:            message.Class,
+		Binary:           message.Type == dto.TYPE_BINARY,
+		SourcePort:       message.SourcePort,
+		DestinationPort:  message.DestinationPort,
+	}
+
+	if options.Priority < 0 || options.Priority > 3 {
+		return options, NewInvalidPayloadError("Invalid priority. Must be from 0 to 3")
+	}
+	if options.ProtocolId < 0 || options.ProtocolId > 255 {
+		return options, NewInvalidPayloadError("Invalid protocol_id. Must be from 0 to 255")
+	}
+	switch options.Class {
+	case "", model.CLASS_FLASH:
+	case model.CLASS_SILENT:
+		//silent messages are sent with their own protocol_id
+		if options.ProtocolId != 0 {
+			return options, NewInvalidPayloadError("Invalid protocol_id. Must be omitted for silent messages")
+		}
+	default:
+		return options, NewInvalidPayloadError("Invalid class. Must be " + model.CLASS_FLASH + " or " + model.CLASS_SILENT)
+	}
+
+	if options.SourcePort < 0 || options.SourcePort > 65535 || options.DestinationPort < 0 || options.DestinationPort > 65535 {
+		return options, NewInvalidPayloadError("Invalid port. Must be from 0 to 65535")
+	}
+	if !options.Binary && (options.SourcePort > 0 || options.DestinationPort > 0) {
+		return options, NewInvalidPayloadError("Invalid port. Ports are supported for binary messages only")
+	}
+
+	if message.DeliverAt != nil {
+		options.DeliverAt = *message.DeliverAt
+		if !options.DeliverAt.After(now) {
+			return options, NewInvalidPayloadError("Invalid deliver_at. Must be in future")
+		}
+	}
+
+	if message.ValidityPeriod != nil {
+		options.ValidityPeriod = *message.ValidityPeriod
+		if !options.ValidityPeriod.After(now) ||
+			(scheduled && !options.ValidityPeriod.After(*message.SendAt)) ||
+			(!options.DeliverAt.IsZero() && !options.ValidityPeriod.After(options.DeliverAt)) {
+			return options, NewInvalidPayloadError("Invalid validity_period. Must be later than send_at and deliver_at")
+		}
+	}
+
+	return options, nil
+}
+
+func (s service) CheckStatusOfMessage(id uint32, history bool) (dto.MessageStatus, error) {
 	msg, err := s.messageDao.GetOneById(id)
 	if err != nil {
 		return dto.MessageStatus{}, err
@@ -212,17 +623,18 @@ func (s service) CheckStatusOfMessage(id uint32) (dto.MessageStatus, error) {
 	}
 	recipientStatuses := []dto.RecipientStatus{}
 	for _, rs := range recipients {
-		recipientStatuses = append(recipientStatuses, dto.RecipientStatus{
-			Phone:  rs.Phone,
-			Status: rs.Status,
-		})
+		recipientStatus, err := s.recipientStatus(rs, history)
+		if err != nil {
+			return dto.MessageStatus{}, err
+		}
+		recipientStatuses = append(recipientStatuses, recipientStatus)
 	}
 	status.Statuses = recipientStatuses
 
 	return status, nil
 }
 
-func (s service) CheckStatusOfRecipient(id uint32, phone string) (dto.MessageStatus, error) {
+func (s service) CheckStatusOfRecipient(id uint32, phone string, history bool) (dto.MessageStatus, error) {
 	msg, err := s.messageDao.GetOneById(id)
 	if err != nil {
 		return dto.MessageStatus{}, err
@@ -237,13 +649,105 @@ func (s service) CheckStatusOfRecipient(id uint32, phone string) (dto.MessageSta
 		Sender: msg.Sender,
 		Text:   msg.Text,
 	}
-	recipientStatuses := []dto.RecipientStatus{
-		{
-			Phone:  recipient.Phone,
-			Status: recipient.Status,
-		},
+	recipientStatus, err := s.recipientStatus(recipient, history)
+	if err != nil {
+		return dto.MessageStatus{}, err
+	}
+	status.Statuses = []dto.RecipientStatus{recipientStatus}
+
+	return status, nil
+}
+
+// recipientStatus converts recipient to dto adding its status history and latencies if requested
+func (s service) recipientStatus(recipient model.Recipient, history bool) (dto.RecipientStatus, error) {
+	status := toRecipientStatusDto(recipient)
+	if !history {
+		return status, nil
+	}
+
+	events, err := s.eventDao.GetAllByRecipientId(recipient.Id)
+	if err != nil {
+		return dto.RecipientStatus{}, err
+	}
+
+	//scheduled recipients are queued for sending at send_at rather than on creation
+	queuedAt := recipient.CreatedAt
+	var submittedAt, doneAt time.Time
+	status.History = []dto.StatusEvent{}
+	for _, event := range events {
+		status.History = append(status.History, dto.StatusEvent{
+			Status:    event.Status,
+			PartNo:    event.PartNo,
+			SmscId:    event.SmscId,
+			ErrorCode: event.ErrorCode,
+			Ignored:   event.Ignored,
+			Time:      event.CreatedAt,
+		})
+
+		if event.Ignored {
+			continue
+		}
+		switch {
+		case event.Status == model.NEW:
+			queuedAt = event.CreatedAt
+		case event.Status == model.SUBMIT_OK:
+			//the last part submitted
+			submittedAt = event.CreatedAt
+		case event.Status != model.SUBMIT_FAIL && event.Status != model.SUBMIT_RETRY && model.IsFinal(event.Status):
+			doneAt = event.CreatedAt
+		}
+	}
+
+	if !submittedAt.IsZero() {
+		status.SubmitLatencyMs = int64(submittedAt.Sub(queuedAt) / time.Millisecond)
+		if !doneAt.IsZero() {
+			status.DeliveryLatencyMs = int64(doneAt.Sub(submittedAt) / time.Millisecond)
+		}
 	}
-	status.Statuses = recipientStatuses
 
 	return status, nil
 }
+
+func (s service) GetInbound(phone string, limit int) ([]dto.InboundMessage, error) {
+	if limit <= 0 {
+		return nil, NewInvalidPayloadError("Invalid limit " + strconv.Itoa(limit))
+	}
+
+	messages, err := s.inboundDao.GetLast(phone, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	inbound := []dto.InboundMessage{}
+	for _, msg := range messages {
+		inbound = append(inbound, toInboundDto(msg))
+	}
+
+	return inbound, nil
+}
+
+func toRecipientStatusDto(recipient model.Recipient) dto.RecipientStatus {
+	status := dto.RecipientStatus{
+		Phone:     recipient.Phone,
+		Status:    recipient.Status,
+		Route:     recipient.Route,
+		ErrorCode: recipient.ErrorCode,
+	}
+	if !recipient.DoneAt.IsZero() {
+		doneAt := recipient.DoneAt
+		status.DoneAt = &doneAt
+	}
+	return status
+}
+
+func toInboundDto(msg model.Inbound) dto.InboundMessage {
+	return dto.InboundMessage{
+		Id:          msg.Id,
+		Phone:       msg.Source,
+		Destination: msg.Destination,
+		Text:        msg.Text,
+		Route:       msg.Route,
+		Partial:     msg.Partial,
+		ReceivedAt:  msg.CreatedAt,
+	}
+}
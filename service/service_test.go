@@ -4,23 +4,31 @@ import (
 	"github.com/asdine/storm/v3/codec/json"
 	"github.com/dilshat/sms-sender/model"
 	"github.com/dilshat/sms-sender/service/dto"
+	"github.com/dilshat/sms-sender/sms"
 	"github.com/stretchr/testify/require"
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 const (
-	STATUS_STORE_DAYS int    = 7
-	MSG_MAX_LEN              = 300
-	ID                uint32 = 123
-	SENDER                   = "Awesome"
-	TEXT                     = "What is up?"
-	PHONE                    = "996ZZZXXXXXX"
-	PHONE2                   = "996YYYAABBCC"
-	JSON_MESSAGE             = `{"id":123,"sender":"Awesome","text":"What is up?","statuses":[{"phone":"996ZZZXXXXXX","status":"DELIVRD"},{"phone":"996YYYAABBCC","status":"ACCEPTD"}]}`
-	JSON_RECIPIENT           = `{"id":123,"sender":"Awesome","text":"What is up?","statuses":[{"phone":"996ZZZXXXXXX","status":"DELIVRD"}]}`
-	PHONE_MASK               = "996\\w{9}"
+	STATUS_STORE_DAYS  int    = 7
+	MSG_MAX_LEN               = 300
+	BINARY_MAX_LEN            = 140
+	RECEIPT_EXPIRY_MIN        = 60
+	ID                 uint32 = 123
+	SENDER                    = "Awesome"
+	TEXT                      = "What is up?"
+	PHONE                     = "996ZZZXXXXXX"
+	PHONE2                    = "996YYYAABBCC"
+	JSON_MESSAGE              = `{"id":123,"sender":"Awesome","text":"What is up?","statuses":[{"phone":"996ZZZXXXXXX","status":"DELIVRD"},{"phone":"996YYYAABBCC","status":"ACCEPTD"}]}`
+	JSON_RECIPIENT            = `{"id":123,"sender":"Awesome","text":"What is up?","statuses":[{"phone":"996ZZZXXXXXX","status":"DELIVRD"}]}`
+	PHONE_MASK                = "996\\w{9}"
 )
 
 var (
@@ -28,6 +36,29 @@ var (
 	deliverStatusUpdated    bool
 	cleanupMessagesCalled   bool
 	cleanupRecipientsCalled bool
+	cleanupSegmentsCalled   bool
+	segmentStatusUpdated    bool
+	cleanupInboundCalled    bool
+	inboundCreated          bool
+	webhookCalled           bool
+	receiptParked           bool
+	receiptsTaken           bool
+	cleanupReceiptsCalled   bool
+	cleanupEventsCalled     bool
+	eventRecorded           bool
+	eventsBase              = time.Date(2020, 4, 2, 11, 33, 0, 0, time.UTC)
+	createdStatus           string
+	updatedStatus           string
+	sentCount               int
+	sentOptions             model.SubmitOptions
+	sentText                string
+	scheduleCreated         bool
+	scheduleRemoved         bool
+	cancelCount             int
+	replacedText            string
+	messageTextUpdated      bool
+	polledStatus            string
+	errNotFound             = errors.New("not found")
 )
 
 type mockMessageDao struct {
@@ -38,7 +69,7 @@ func (m mockMessageDao) RemoveOlderThanDays(days int) error {
 	return nil
 }
 
-func (m mockMessageDao) Create(text, sender string) (uint32, error) {
+func (m mockMessageDao) Create(text, sender string, options model.SubmitOptions) (uint32, error) {
 	return 1, nil
 }
 
@@ -51,11 +82,24 @@ func (m mockMessageDao) GetOneById(id uint32) (model.Message, error) {
 	}, nil
 }
 
+func (m mockMessageDao) UpdateText(id uint32, text string) error {
+	messageTextUpdated = true
+	return nil
+}
+
 func (m mockMessageDao) GetAll() ([]model.Message, error) {
 	return nil, nil
 }
 
 type mockRecipientDao struct {
+	//delivery ids are not stored yet
+	unknownDeliverId bool
+	//recipients await scheduled sending
+	scheduled bool
+	//recipients returned instead of the default ones
+	recipients []model.Recipient
+	//error of status updates
+	updateErr error
 }
 
 func (m mockRecipientDao) RemoveOlderThanDays(days int) error {
@@ -63,21 +107,42 @@ func (m mockRecipientDao) RemoveOlderThanDays(days int) error {
 	return nil
 }
 
-func (m mockRecipientDao) Create(messageId uint32, phone string) (uint32, error) {
+func (m mockRecipientDao) Create(messageId uint32, phone, status string) (uint32, error) {
+	createdStatus = status
 	return 2, nil
 }
 
-func (m mockRecipientDao) UpdateSubmitStatus(id uint32, deliverId string, status string) error {
+func (m mockRecipientDao) UpdateSubmitStatus(id uint32, deliverId, status, route string) error {
 	submitStatusUpdated = true
 	return nil
 }
 
-func (m mockRecipientDao) UpdateDeliverStatus(deliverId string, status string) (uint32, string, error) {
+func (m mockRecipientDao) UpdateDeliverStatus(deliverId, status, errorCode string, doneAt time.Time) (uint32, string, error) {
+	if m.unknownDeliverId {
+		return 0, "", errNotFound
+	}
 	deliverStatusUpdated = true
 	return 0, "", nil
 }
 
+func (m mockRecipientDao) UpdateStatus(id uint32, status, errorCode string, doneAt time.Time) (uint32, string, error) {
+	if m.updateErr != nil {
+		return 0, "", m.updateErr
+	}
+	deliverStatusUpdated = true
+	updatedStatus = status
+	return ID, PHONE, nil
+}
+
 func (m mockRecipientDao) GetOneByMessageIdAndPhone(messageId uint32, phone string) (model.Recipient, error) {
+	if m.recipients != nil {
+		for _, recipient := range m.recipients {
+			if recipient.Phone == phone {
+				return recipient, nil
+			}
+		}
+		return model.Recipient{}, errNotFound
+	}
 	return model.Recipient{
 		Id:        1,
 		MessageId: ID,
@@ -88,6 +153,15 @@ func (m mockRecipientDao) GetOneByMessageIdAndPhone(messageId uint32, phone stri
 }
 
 func (m mockRecipientDao) GetAllByMessageId(messageId uint32) ([]model.Recipient, error) {
+	if m.recipients != nil {
+		return m.recipients, nil
+	}
+	if m.scheduled {
+		return []model.Recipient{
+			{Id: 1, MessageId: ID, Phone: PHONE, Status: model.SCHEDULED},
+			{Id: 2, MessageId: ID, Phone: PHONE2, Status: model.SCHEDULED},
+		}, nil
+	}
 	return []model.Recipient{
 		{
 			Id:        1,
@@ -108,29 +182,252 @@ func (m mockRecipientDao) GetAllByMessageId(messageId uint32) ([]model.Recipient
 	}, nil
 }
 
+func (m mockRecipientDao) GetOneById(id uint32) (model.Recipient, error) {
+	for _, recipient := range m.recipients {
+		if recipient.Id == id {
+			return recipient, nil
+		}
+	}
+	return model.Recipient{}, errNotFound
+}
+
+func (m mockRecipientDao) GetAllByStatus(statuses ...string) ([]model.Recipient, error) {
+	var recipients []model.Recipient
+	for _, recipient := range m.recipients {
+		for _, status := range statuses {
+			if recipient.Status == status {
+				recipients = append(recipients, recipient)
+				break
+			}
+		}
+	}
+	return recipients, nil
+}
+
 func (m mockRecipientDao) GetAll() ([]model.Recipient, error) {
 	return nil, nil
 }
 
+type mockSegmentDao struct {
+	unknownDeliverId bool
+	//recipients have single part messages
+	single bool
+	//no part of messages is submitted yet
+	unsent bool
+	//parts returned as awaiting receipt
+	awaiting []model.Segment
+}
+
+func (m mockSegmentDao) UpdateSubmitStatus(recipientId uint32, partNo, partsCount int, deliverId string, status string) error {
+	segmentStatusUpdated = true
+	return nil
+}
+
+func (m mockSegmentDao) UpdateDeliverStatus(deliverId, status, errorCode string, doneAt time.Time) (uint32, error) {
+	if m.unknownDeliverId {
+		return 0, errNotFound
+	}
+	segmentStatusUpdated = true
+	polledStatus = status
+	return 2, nil
+}
+
+func (m mockSegmentDao) GetAllByRecipientId(recipientId uint32) ([]model.Segment, error) {
+	if m.unsent {
+		return nil, nil
+	}
+	if m.single {
+		return []model.Segment{
+			{Id: 1, RecipientId: recipientId, PartNo: 1, PartsCount: 1, Status: model.SUBMIT_OK, DeliverId: "321"},
+		}, nil
+	}
+	return []model.Segment{
+		{Id: 1, RecipientId: recipientId, PartNo: 1, PartsCount: 2, Status: model.SUBMIT_OK, DeliverId: "321"},
+		{Id: 2, RecipientId: recipientId, PartNo: 2, PartsCount: 2, Status: model.DELIVRD},
+	}, nil
+}
+
+func (m mockSegmentDao) GetAllByStatus(statuses ...string) ([]model.Segment, error) {
+	return m.awaiting, nil
+}
+
+func (m mockSegmentDao) RemoveOlderThanDays(days int) error {
+	cleanupSegmentsCalled = true
+	return nil
+}
+
+type mockScheduleDao struct {
+	due []model.Schedule
+	//schedule is already removed
+	removed bool
+}
+
+func (m mockScheduleDao) Create(messageId uint32, sendAt, expiresAt time.Time) error {
+	scheduleCreated = true
+	return nil
+}
+
+func (m mockScheduleDao) GetDue(now time.Time) ([]model.Schedule, error) {
+	return m.due, nil
+}
+
+func (m mockScheduleDao) RemoveByMessageId(messageId uint32) error {
+	if m.removed {
+		return errNotFound
+	}
+	scheduleRemoved = true
+	return nil
+}
+
+type mockStatusEventDao struct {
+	//history starts with the scheduled message queued for sending
+	scheduled bool
+}
+
+func (m mockStatusEventDao) Create(recipientId uint32, partNo int, status, smscId, errorCode string, ignored bool) error {
+	eventRecorded = true
+	return nil
+}
+
+func (m mockStatusEventDao) GetAllByRecipientId(recipientId uint32) ([]model.StatusEvent, error) {
+	var events []model.StatusEvent
+	if m.scheduled {
+		events = append(events, model.StatusEvent{RecipientId: recipientId, Status: model.NEW, CreatedAt: eventsBase})
+	}
+	return append(events, []model.StatusEvent{
+		{Id: 1, RecipientId: recipientId, PartNo: 1, Status: model.SUBMIT_RETRY, ErrorCode: "0x00000058", CreatedAt: eventsBase.Add(time.Second)},
+		{Id: 2, RecipientId: recipientId, PartNo: 1, Status: model.SUBMIT_OK, SmscId: "321", CreatedAt: eventsBase.Add(3 * time.Second)},
+		{Id: 3, RecipientId: recipientId, Status: model.DELIVRD, SmscId: "321", CreatedAt: eventsBase.Add(8 * time.Second)},
+		{Id: 4, RecipientId: recipientId, Status: model.ENROUTE, SmscId: "321", Ignored: true, CreatedAt: eventsBase.Add(9 * time.Second)},
+	}...), nil
+}
+
+func (m mockStatusEventDao) RemoveOlderThanDays(days int) error {
+	cleanupEventsCalled = true
+	return nil
+}
+
+type mockPendingReceiptDao struct {
+}
+
+func (m mockPendingReceiptDao) Create(deliverId, status, errorCode string, doneAt time.Time) error {
+	receiptParked = true
+	return nil
+}
+
+func (m mockPendingReceiptDao) TakeByDeliverId(deliverId string) ([]model.PendingReceipt, error) {
+	receiptsTaken = true
+	return []model.PendingReceipt{{Id: 1, DeliverId: deliverId, Status: model.DELIVRD, CreatedAt: time.Now()}}, nil
+}
+
+func (m mockPendingReceiptDao) RemoveOlderThan(age time.Duration) error {
+	cleanupReceiptsCalled = true
+	return nil
+}
+
+type mockInboundDao struct {
+}
+
+func (m mockInboundDao) Create(source, destination, text, route string, partial bool) (uint32, error) {
+	inboundCreated = true
+	return ID, nil
+}
+
+func (m mockInboundDao) GetOneById(id uint32) (model.Inbound, error) {
+	return model.Inbound{Id: id, Source: PHONE, Destination: SENDER, Text: TEXT}, nil
+}
+
+func (m mockInboundDao) GetLast(source string, limit int) ([]model.Inbound, error) {
+	return []model.Inbound{
+		{Id: 2, Source: PHONE, Destination: SENDER, Text: TEXT},
+		{Id: 1, Source: PHONE2, Destination: SENDER, Text: TEXT},
+	}, nil
+}
+
+func (m mockInboundDao) RemoveOlderThanDays(days int) error {
+	cleanupInboundCalled = true
+	return nil
+}
+
 type mockSender struct {
+	//messages are still in the outgoing queue
+	queued bool
+	err    error
+	//state reported by query_sm
+	state string
+	//no route serves phones
+	noRoute bool
+	//sender cannot be sent as source address
+	invalidSender bool
 }
 
 func (m mockSender) Start() error {
 	return nil
 }
 
-func (m mockSender) BindSubmitSmResponseHandler(handler func(id, status uint32, smscId string)) {
+func (m mockSender) BindSubmitSmResponseHandler(handler func(result sms.SubmitResult)) {
+}
+
+func (m mockSender) BindDeliverSmHandler(handler func(receipt sms.Receipt)) {
+}
+
+func (m mockSender) BindInboundHandler(handler func(msg sms.InboundMessage)) {
+}
+
+func (m mockSender) Send(id uint32, sender, phone, text string, options model.SubmitOptions) error {
+	sentCount++
+	sentOptions = options
+	sentText = text
+	return nil
 }
 
-func (m mockSender) BindDeliverSmHandler(handler func(smscId string, status string)) {
+func (m mockSender) Route(phone string) (string, error) {
+	if m.noRoute {
+		return "", errors.New("No SMSC route for phone " + phone)
+	}
+	return "default", nil
 }
 
-func (m mockSender) Send(id uint32, sender, phone, text string) error {
+func (m mockSender) ValidateSender(route, sender string) error {
+	if m.invalidSender {
+		return errors.New("Alphanumeric sender is too long. Must be <= 11 characters")
+	}
 	return nil
 }
 
+func (m mockSender) Queued(id uint32) (bool, error) {
+	return m.queued, nil
+}
+
+func (m mockSender) Dequeue(id uint32) (bool, error) {
+	return m.queued, nil
+}
+
+func (m mockSender) ReplaceQueued(id uint32, text string) (bool, error) {
+	if m.queued {
+		replacedText = text
+	}
+	return m.queued, nil
+}
+
+func (m mockSender) Cancel(route, sender, phone, smscId string) error {
+	cancelCount++
+	return m.err
+}
+
+func (m mockSender) Query(route, sender, smscId string) (sms.Receipt, error) {
+	return sms.Receipt{SmscId: smscId, Status: m.state}, m.err
+}
+
+func (m mockSender) Replace(route, sender, smscId, originalText, text string) error {
+	if m.err == nil {
+		replacedText = text
+	}
+	return m.err
+}
+
 func TestService_SendMessage(t *testing.T) {
-	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, STATUS_STORE_DAYS, MSG_MAX_LEN, "", PHONE_MASK)
+	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK)
 
 	id, err := service.SendMessage(dto.Message{
 		Sender: SENDER,
@@ -146,12 +443,110 @@ func TestService_SendMessage(t *testing.T) {
 
 	require.True(t, cleanupMessagesCalled)
 	require.True(t, cleanupRecipientsCalled)
+	require.True(t, cleanupSegmentsCalled)
+	require.True(t, cleanupInboundCalled)
+	require.True(t, cleanupReceiptsCalled)
+	require.True(t, cleanupEventsCalled)
+
+	//phone without route is rejected before anything is stored
+	count := sentCount
+	service = NewService(mockSender{noRoute: true}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK)
+
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}})
+
+	require.Error(t, err)
+	require.IsType(t, &InvalidPayloadErr{}, err)
+	require.Equal(t, count, sentCount)
+}
+
+func TestService_SendMessageOptions(t *testing.T) {
+	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK)
+	deliverAt := time.Now().Add(time.Hour)
+	validityPeriod := deliverAt.Add(time.Hour)
+
+	_, err := service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE},
+		ValidityPeriod: &validityPeriod, DeliverAt: &deliverAt, Priority: 1, ProtocolId: 64, ReplaceIfPresent: true})
+
+	require.NoError(t, err)
+	require.Equal(t, model.SubmitOptions{ValidityPeriod: validityPeriod, DeliverAt: deliverAt, Priority: 1, ProtocolId: 64, ReplaceIfPresent: true}, sentOptions)
+
+	//invalid priority
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, Priority: 4})
+
+	require.Error(t, err)
+
+	//invalid protocol id
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, ProtocolId: 256})
+
+	require.Error(t, err)
+
+	//validity period before delivery time
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, ValidityPeriod: &deliverAt, DeliverAt: &validityPeriod})
+
+	require.Error(t, err)
+
+	//sender that cannot be sent as source address via the route
+	_, err = NewService(mockSender{invalidSender: true}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK).
+		SendMessage(dto.Message{Sender: "TooLongSender", Text: TEXT, Phones: []string{PHONE}})
+
+	require.IsType(t, &InvalidPayloadErr{}, err)
+
+	//unknown class
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, Class: "class2"})
+
+	require.Error(t, err)
+
+	//silent message with protocol id
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, Class: model.CLASS_SILENT, ProtocolId: 1})
+
+	require.Error(t, err)
+
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, Class: model.CLASS_FLASH})
+
+	require.NoError(t, err)
+	require.Equal(t, model.CLASS_FLASH, sentOptions.Class)
+
+	//delivery time in past
+	past := time.Now().Add(-time.Hour)
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, DeliverAt: &past})
+
+	require.Error(t, err)
+}
+
+func TestService_SendMessageBinary(t *testing.T) {
+	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK)
+
+	_, err := service.SendMessage(dto.Message{Sender: SENDER, Text: "AQID", Phones: []string{PHONE}, Type: dto.TYPE_BINARY, Encoding: dto.ENCODING_BASE64, SourcePort: 16, DestinationPort: 2948})
+
+	require.NoError(t, err)
+	require.Equal(t, "010203", sentText)
+	require.Equal(t, model.SubmitOptions{Binary: true, SourcePort: 16, DestinationPort: 2948}, sentOptions)
+
+	//invalid hex
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: "xyz", Phones: []string{PHONE}, Type: dto.TYPE_BINARY})
+
+	require.Error(t, err)
+
+	//payload is limited in bytes
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: strings.Repeat("00", BINARY_MAX_LEN+1), Phones: []string{PHONE}, Type: dto.TYPE_BINARY})
+
+	require.IsType(t, &InvalidPayloadErr{}, err)
+
+	//ports of text message
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: TEXT, Phones: []string{PHONE}, DestinationPort: 2948})
+
+	require.Error(t, err)
+
+	//port out of range
+	_, err = service.SendMessage(dto.Message{Sender: SENDER, Text: "0102", Phones: []string{PHONE}, Type: dto.TYPE_BINARY, DestinationPort: 65536})
+
+	require.Error(t, err)
 }
 
 func TestService_CheckStatusOfMessage(t *testing.T) {
-	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, STATUS_STORE_DAYS, MSG_MAX_LEN, "", PHONE_MASK)
+	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK)
 
-	status, err := service.CheckStatusOfMessage(ID)
+	status, err := service.CheckStatusOfMessage(ID, false)
 
 	require.NoError(t, err)
 	require.NotEmpty(t, status)
@@ -165,9 +560,9 @@ func TestService_CheckStatusOfMessage(t *testing.T) {
 }
 
 func TestService_CheckStatusOfRecipient(t *testing.T) {
-	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, STATUS_STORE_DAYS, MSG_MAX_LEN, "", PHONE_MASK)
+	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK)
 
-	status, err := service.CheckStatusOfRecipient(ID, PHONE)
+	status, err := service.CheckStatusOfRecipient(ID, PHONE, false)
 
 	require.NoError(t, err)
 	require.NotEmpty(t, status)
@@ -182,14 +577,117 @@ func TestService_CheckStatusOfRecipient(t *testing.T) {
 
 func TestImp_HandleSubmitSmResp(t *testing.T) {
 	impl := &service{
-		sender:       mockSender{},
-		messageDao:   mockMessageDao{},
-		recipientDao: mockRecipientDao{},
+		sender:        mockSender{},
+		messageDao:    mockMessageDao{},
+		recipientDao:  mockRecipientDao{},
+		segmentDao:    mockSegmentDao{},
+		receiptDao:    mockPendingReceiptDao{},
+		eventDao:      mockStatusEventDao{},
+		receiptExpiry: time.Minute,
+		receiptMu:     &sync.Mutex{},
 	}
+	deliverStatusUpdated = false
 
-	impl.HandleSubmitSmResp(ID, 0, "123")
+	impl.HandleSubmitSmResp(sms.SubmitResult{Id: ID, PartNo: 1, PartsCount: 2, SmscId: "123", Route: "default"})
 
+	require.True(t, segmentStatusUpdated)
 	require.True(t, submitStatusUpdated)
+	//receipt received before the submit response is applied
+	require.True(t, receiptsTaken)
+	require.True(t, deliverStatusUpdated)
+	require.True(t, eventRecorded)
+
+	//retry is recorded in history only
+	eventRecorded = false
+	submitStatusUpdated = false
+
+	impl.HandleSubmitSmResp(sms.SubmitResult{Id: ID, PartNo: 1, PartsCount: 2, Status: 0x58, Retry: true})
+
+	require.True(t, eventRecorded)
+	require.False(t, submitStatusUpdated)
+}
+
+func TestService_recipientStatus(t *testing.T) {
+	impl := &service{eventDao: mockStatusEventDao{}}
+	recipient := model.Recipient{Id: 1, Phone: PHONE, Status: model.DELIVRD, CreatedAt: eventsBase}
+
+	status, err := impl.recipientStatus(recipient, false)
+
+	require.NoError(t, err)
+	require.Nil(t, status.History)
+
+	status, err = impl.recipientStatus(recipient, true)
+
+	require.NoError(t, err)
+	require.Equal(t, 4, len(status.History))
+	require.Equal(t, model.SUBMIT_RETRY, status.History[0].Status)
+	require.True(t, status.History[3].Ignored)
+	require.Equal(t, int64(3000), status.SubmitLatencyMs)
+	require.Equal(t, int64(5000), status.DeliveryLatencyMs)
+
+	//submit latency of a scheduled message starts when it is due
+	impl.eventDao = mockStatusEventDao{scheduled: true}
+	recipient.CreatedAt = eventsBase.Add(-time.Hour)
+
+	status, err = impl.recipientStatus(recipient, true)
+
+	require.NoError(t, err)
+	require.Equal(t, 5, len(status.History))
+	require.Equal(t, int64(3000), status.SubmitLatencyMs)
+}
+
+func TestAggregateStatus(t *testing.T) {
+	require.Equal(t, model.NEW, aggregateStatus(nil))
+
+	//least advanced segment wins
+	require.Equal(t, model.SUBMIT_OK, aggregateStatus([]model.Segment{
+		{PartNo: 1, PartsCount: 2, Status: model.DELIVRD},
+		{PartNo: 2, PartsCount: 2, Status: model.SUBMIT_OK},
+	}))
+
+	//failed segment fails the whole message
+	require.Equal(t, model.SUBMIT_FAIL, aggregateStatus([]model.Segment{
+		{PartNo: 1, PartsCount: 3, Status: model.DELIVRD},
+		{PartNo: 2, PartsCount: 3, Status: model.SUBMIT_FAIL},
+		{PartNo: 3, PartsCount: 3, Status: model.DELIVRD},
+	}))
+
+	require.Equal(t, model.UNDELIV, aggregateStatus([]model.Segment{
+		{PartNo: 1, PartsCount: 2, Status: model.ENROUTE},
+		{PartNo: 2, PartsCount: 2, Status: model.UNDELIV},
+	}))
+
+	//not all segments are responded
+	require.Equal(t, model.NEW, aggregateStatus([]model.Segment{
+		{PartNo: 1, PartsCount: 2, Status: model.SUBMIT_OK},
+	}))
+
+	require.Equal(t, model.DELIVRD, aggregateStatus([]model.Segment{
+		{PartNo: 1, PartsCount: 2, Status: model.DELIVRD},
+		{PartNo: 2, PartsCount: 2, Status: model.DELIVRD},
+	}))
+}
+
+func TestIgnoredTransition(t *testing.T) {
+	require.True(t, ignoredTransition(model.IgnoredTransitionErr{From: model.DELIVRD, To: model.SUBMIT_OK}))
+	require.False(t, ignoredTransition(NewInvalidPayloadError("not found")))
+}
+
+func TestAggregateReceipt(t *testing.T) {
+	doneAt := time.Now()
+	segments := []model.Segment{
+		{PartNo: 1, PartsCount: 2, Status: model.DELIVRD, ErrorCode: "000", DoneAt: doneAt.Add(time.Minute)},
+		{PartNo: 2, PartsCount: 2, Status: model.UNDELIV, ErrorCode: "034", DoneAt: doneAt},
+	}
+
+	errorCode, failedAt := aggregateReceipt(segments, model.UNDELIV)
+
+	require.Equal(t, "034", errorCode)
+	require.Equal(t, doneAt, failedAt)
+
+	errorCode, _ = aggregateReceipt(segments, model.NEW)
+
+	require.Equal(t, "", errorCode)
 }
 
 // RoundTripFunc .
@@ -200,7 +698,7 @@ func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return f(req), nil
 }
 
-//NewTestClient returns *http.Client with Transport replaced to avoid making real calls
+// NewTestClient returns *http.Client with Transport replaced to avoid making real calls
 func NewTestClient(fn RoundTripFunc) *http.Client {
 	return &http.Client{
 		Transport: RoundTripFunc(fn),
@@ -224,11 +722,62 @@ func TestImp_HandleDeliverSm(t *testing.T) {
 		sender:       mockSender{},
 		messageDao:   mockMessageDao{},
 		recipientDao: mockRecipientDao{},
+		segmentDao:   mockSegmentDao{},
+		eventDao:     mockStatusEventDao{},
 		httpClient:   client,
 		webhook:      "http://www.kg",
+		receiptMu:    &sync.Mutex{},
 	}
+	eventRecorded = false
 
-	impl.HandleDeliverSm("123", "status")
+	impl.HandleDeliverSm(sms.Receipt{SmscId: "123", Status: "status"})
 
 	require.True(t, deliverStatusUpdated)
+	require.True(t, eventRecorded)
+
+	//receipt for a delivery id not stored yet is parked
+	impl.segmentDao = mockSegmentDao{unknownDeliverId: true}
+	impl.recipientDao = mockRecipientDao{unknownDeliverId: true}
+	impl.receiptDao = mockPendingReceiptDao{}
+
+	impl.HandleDeliverSm(sms.Receipt{SmscId: "124", Status: model.DELIVRD})
+
+	require.True(t, receiptParked)
+}
+
+func TestImp_HandleInbound(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		webhookCalled = true
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`OK`)),
+			Header:     make(http.Header),
+		}
+	})
+
+	impl := &service{
+		sender:         mockSender{},
+		inboundDao:     mockInboundDao{},
+		httpClient:     client,
+		inboundWebhook: "http://www.kg",
+	}
+
+	impl.HandleInbound(sms.InboundMessage{Source: PHONE, Destination: SENDER, Text: TEXT})
+
+	require.True(t, inboundCreated)
+	require.True(t, webhookCalled)
+}
+
+func TestService_GetInbound(t *testing.T) {
+	service := NewService(mockSender{}, mockMessageDao{}, mockRecipientDao{}, mockSegmentDao{}, mockInboundDao{}, mockPendingReceiptDao{}, mockStatusEventDao{}, mockScheduleDao{}, STATUS_STORE_DAYS, RECEIPT_EXPIRY_MIN, 0, 0, MSG_MAX_LEN, BINARY_MAX_LEN, "", "", PHONE_MASK)
+
+	messages, err := service.GetInbound("", 10)
+
+	require.NoError(t, err)
+	require.Equal(t, 2, len(messages))
+	require.Equal(t, PHONE, messages[0].Phone)
+
+	_, err = service.GetInbound("", 0)
+
+	require.Error(t, err)
 }
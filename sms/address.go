@@ -0,0 +1,110 @@
+package sms
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// type of number and numbering plan indicator values
+const (
+	tonInternational   = 1
+	tonNational        = 2
+	tonNetworkSpecific = 3
+	tonAlphanumeric    = 5
+
+	npiUnknown = 0
+	npiIsdn    = 1
+
+	maxAlphanumericLen = 11
+	maxShortCodeLen    = 8
+	maxNumberLen       = 15
+)
+
+// address is an SMPP address with its type of number and numbering plan indicator
+type address struct {
+	addr string
+	ton  int
+	npi  int
+}
+
+// senderAddress detects TON/NPI from the sender format: short code of up to 8 digits,
+// international number of up to 15 digits with optional leading + or alphanumeric sender of up to 11 GSM 03.38 characters
+func senderAddress(sender string) (address, error) {
+	if sender == "" {
+		return address{}, errors.New("Sender is empty")
+	}
+
+	number := strings.TrimPrefix(sender, "+")
+	if isDigits(number) {
+		switch {
+		case len(number) > maxNumberLen:
+			return address{}, errors.New("Sender number is too long. Must be <= 15 digits")
+		case len(number) <= maxShortCodeLen && number == sender:
+			return address{addr: number, ton: tonNetworkSpecific, npi: npiUnknown}, nil
+		default:
+			return address{addr: number, ton: tonInternational, npi: npiIsdn}, nil
+		}
+	}
+
+	return alphanumericAddress(sender)
+}
+
+// alphanumericAddress returns address of the sender of up to 11 GSM 03.38 characters
+func alphanumericAddress(sender string) (address, error) {
+	septets, ok := encodeGsm7(sender)
+	if !ok {
+		return address{}, errors.New("Alphanumeric sender must be in GSM 03.38 alphabet")
+	}
+	if len(septets) > maxAlphanumericLen {
+		return address{}, errors.New("Alphanumeric sender is too long. Must be <= 11 characters")
+	}
+	return address{addr: sender, ton: tonAlphanumeric, npi: npiUnknown}, nil
+}
+
+// ValidateSender checks if the sender can be sent as source address, the sender must match TON configured for SMSC
+func (c *smppClient) ValidateSender(sender string) error {
+	if sender == "" {
+		return errors.New("Sender is empty")
+	}
+
+	switch c.sourceTon {
+	case tonAlphanumeric:
+		_, err := alphanumericAddress(sender)
+		return err
+	case tonInternational, tonNational:
+		number := strings.TrimPrefix(sender, "+")
+		if !isDigits(number) || len(number) > maxNumberLen {
+			return errors.New("Sender must be a number of up to 15 digits for TON " + strconv.Itoa(c.sourceTon) + " of SMSC")
+		}
+		return nil
+	}
+
+	_, err := senderAddress(sender)
+	return err
+}
+
+// source returns source address of the sender, TON/NPI configured for SMSC take precedence over detected ones
+func (c *smppClient) source(sender string) address {
+	addr, err := senderAddress(sender)
+	if err != nil {
+		//not validated sender is sent as is
+		addr = address{addr: sender, ton: tonAlphanumeric, npi: npiUnknown}
+	}
+	if c.sourceTon >= 0 {
+		addr.ton = c.sourceTon
+	}
+	if c.sourceNpi >= 0 {
+		addr.npi = c.sourceNpi
+	}
+	return addr
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,76 @@
+package sms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSenderAddress(t *testing.T) {
+	addr, err := senderAddress("Awesome")
+
+	require.NoError(t, err)
+	require.Equal(t, address{addr: "Awesome", ton: tonAlphanumeric, npi: npiUnknown}, addr)
+
+	addr, err = senderAddress("1414")
+
+	require.NoError(t, err)
+	require.Equal(t, address{addr: "1414", ton: tonNetworkSpecific, npi: npiUnknown}, addr)
+
+	//international number is sent without plus
+	addr, err = senderAddress("+996555123456")
+
+	require.NoError(t, err)
+	require.Equal(t, address{addr: "996555123456", ton: tonInternational, npi: npiIsdn}, addr)
+
+	addr, err = senderAddress("996555123456")
+
+	require.NoError(t, err)
+	require.Equal(t, tonInternational, addr.ton)
+
+	//senders that cannot be represented
+	_, err = senderAddress("")
+
+	require.Error(t, err)
+
+	_, err = senderAddress("TooLongSender")
+
+	require.Error(t, err)
+
+	_, err = senderAddress("Привет")
+
+	require.Error(t, err)
+
+	_, err = senderAddress("+9965551234567890")
+
+	require.Error(t, err)
+}
+
+func TestSmppClient_ValidateSender(t *testing.T) {
+	c := smppClient{sourceTon: -1, sourceNpi: -1}
+
+	require.NoError(t, c.ValidateSender("Awesome"))
+	require.Error(t, c.ValidateSender("TooLongSender"))
+
+	//sender must match TON configured for SMSC
+	c = smppClient{sourceTon: tonInternational, sourceNpi: -1}
+
+	require.NoError(t, c.ValidateSender("+996555123456"))
+	require.Error(t, c.ValidateSender("Awesome"))
+
+	c = smppClient{sourceTon: tonAlphanumeric, sourceNpi: -1}
+
+	require.NoError(t, c.ValidateSender("1414"))
+	require.Error(t, c.ValidateSender("Привет"))
+}
+
+func TestSmppClient_source(t *testing.T) {
+	c := smppClient{sourceTon: -1, sourceNpi: -1}
+
+	require.Equal(t, address{addr: "1414", ton: tonNetworkSpecific, npi: npiUnknown}, c.source("1414"))
+
+	//TON/NPI configured for SMSC take precedence
+	c = smppClient{sourceTon: 0, sourceNpi: 1}
+
+	require.Equal(t, address{addr: "1414", ton: 0, npi: 1}, c.source("1414"))
+}
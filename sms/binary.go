@@ -0,0 +1,45 @@
+package sms
+
+const (
+	//octets of short_message available for user data header and payload
+	maxShortMessageLength = 140
+
+	//information element identifiers of application port addressing
+	iePort8  byte = 0x04
+	iePort16 byte = 0x05
+
+	maxPort8 = 255
+)
+
+// hasPorts checks if the message is addressed to an application port
+func hasPorts(sourcePort, destinationPort int) bool {
+	return sourcePort > 0 || destinationPort > 0
+}
+
+// portIe returns application port addressing element, 8-bit if both ports fit one octet
+func portIe(sourcePort, destinationPort int) []byte {
+	if sourcePort <= maxPort8 && destinationPort <= maxPort8 {
+		return []byte{iePort8, 2, byte(destinationPort), byte(sourcePort)}
+	}
+	return []byte{iePort16, 4, byte(destinationPort >> 8), byte(destinationPort), byte(sourcePort >> 8), byte(sourcePort)}
+}
+
+// binaryParts splits 8-bit data into parts leaving room for user data header made of
+// other elements of portLen octets and concatenation element of ieLen octets if it does not fit one part
+func binaryParts(data []byte, portLen, ieLen int) [][]byte {
+	udhLen := 0
+	if portLen > 0 {
+		udhLen = 1 + portLen
+	}
+	if udhLen+len(data) <= maxShortMessageLength {
+		return [][]byte{data}
+	}
+
+	partLength := maxShortMessageLength - 1 - portLen - ieLen
+	var parts [][]byte
+	for len(data) > partLength {
+		parts = append(parts, data[:partLength])
+		data = data[partLength:]
+	}
+	return append(parts, data)
+}
@@ -0,0 +1,33 @@
+package sms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortIe(t *testing.T) {
+	require.Equal(t, []byte{iePort8, 2, 200, 16}, portIe(16, 200))
+	require.Equal(t, []byte{iePort16, 4, 0x0B, 0x84, 0x23, 0xF0}, portIe(9200, 2948))
+}
+
+func TestBinaryParts(t *testing.T) {
+	//fits one part with port element
+	parts := binaryParts(bytes.Repeat([]byte{0xAB}, 133), 6, 5)
+
+	require.Len(t, parts, 1)
+
+	//128 octets of data per part with 16-bit ports and 8-bit reference
+	parts = binaryParts(bytes.Repeat([]byte{0xAB}, 300), 6, 5)
+
+	require.Len(t, parts, 3)
+	require.Len(t, parts[0], 128)
+	require.Len(t, parts[2], 300-2*128)
+
+	//concatenation without ports
+	parts = binaryParts(bytes.Repeat([]byte{0xAB}, 141), 0, 5)
+
+	require.Len(t, parts, 2)
+	require.Len(t, parts[0], 134)
+}
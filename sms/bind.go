@@ -0,0 +1,119 @@
+package sms
+
+import (
+	"sync/atomic"
+
+	smpp "github.com/Dilshat/smpp34"
+	"go.uber.org/zap"
+)
+
+// bind modes
+const (
+	//single transceiver bind for submits and deliver_sm
+	BIND_MODE_TRX = "trx"
+	//transmitter bind for submits and receiver bind for deliver_sm
+	BIND_MODE_TXRX = "txrx"
+)
+
+// BindConfig holds bind mode and optional bind parameters of SMSC connection, zero values are not sent
+type BindConfig struct {
+	//Mode is BIND_MODE_TRX or BIND_MODE_TXRX
+	Mode       string
+	SystemType string
+	//InterfaceVersion is 0x34 unless set
+	InterfaceVersion int
+	AddressRange     string
+}
+
+// bindParams returns parameters of bind_transceiver, bind_transmitter and bind_receiver
+func (c *smppClient) bindParams() smpp.Params {
+	params := smpp.Params{
+		smpp.SYSTEM_ID: c.smscAccount,
+		smpp.PASSWORD:  c.smscPassword,
+	}
+	if c.bind.SystemType != "" {
+		params[smpp.SYSTEM_TYPE] = c.bind.SystemType
+	}
+	if c.bind.InterfaceVersion > 0 {
+		params[smpp.INTERFACE_VERSION] = c.bind.InterfaceVersion
+	}
+	if c.bind.AddressRange != "" {
+		params[smpp.ADDRESS_RANGE] = c.bind.AddressRange
+	}
+	return params
+}
+
+// dial opens a session bound with the bind command
+func (c *smppClient) dial(bindId smpp.CMDId) (TransceiverWrapper, error) {
+	return c.transceiverFactory.GetTransceiver(c.smscIp, c.smscPort, c.smscEnqLnkIntrvl, bindId, c.bindParams())
+}
+
+// dialTransmitterReceiver opens transmitter bind for submits and receiver bind for deliver_sm,
+// the receiver is read in the background until it is closed
+func (c *smppClient) dialTransmitterReceiver() error {
+	transmitter, err := c.dial(smpp.BIND_TRANSMITTER)
+	if err != nil {
+		return err
+	}
+
+	receiver, err := c.dial(smpp.BIND_RECEIVER)
+	if err != nil {
+		transmitter.Close()
+		return err
+	}
+
+	c.transceiver = transmitter
+	c.receiverMu.Lock()
+	c.receiver = receiver
+	c.receiverMu.Unlock()
+
+	go c.readReceiver(receiver)
+
+	return nil
+}
+
+// readReceiver processes PDUs of the receiver bind, the client is marked disconnected once the receiver breaks
+// so that both binds are reopened
+func (c *smppClient) readReceiver(receiver TransceiverWrapper) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			zap.L().Error("Recovered in readReceiver")
+		}
+		c.dropReceiver(receiver)
+	}()
+
+	for {
+		err := c.read(receiver)
+		if err != nil {
+			if _, ok := err.(smpp.SmppErr); !ok {
+				zap.L().Warn("Receiver bind is broken", zap.Error(err))
+				return
+			}
+		}
+	}
+}
+
+// dropReceiver marks the client disconnected if the receiver is still in use,
+// receivers replaced by reconnect are ignored
+func (c *smppClient) dropReceiver(receiver TransceiverWrapper) {
+	c.receiverMu.Lock()
+	defer c.receiverMu.Unlock()
+
+	if c.receiver == receiver {
+		atomic.StoreInt32(&c.connected, 0)
+	}
+}
+
+// closeReceiver unbinds and closes the receiver bind if it is open
+func (c *smppClient) closeReceiver() {
+	c.receiverMu.Lock()
+	receiver := c.receiver
+	c.receiver = nil
+	c.receiverMu.Unlock()
+
+	if receiver != nil {
+		_ = receiver.Unbind()
+		receiver.Close()
+	}
+}
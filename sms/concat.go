@@ -0,0 +1,109 @@
+package sms
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+
+	smpp "github.com/Dilshat/smpp34"
+	"go.uber.org/zap"
+)
+
+// modes of linking parts of a long message
+const (
+	//concatenation UDH with 8-bit reference
+	CONCAT_UDH8 = "udh8"
+	//concatenation UDH with 16-bit reference
+	CONCAT_UDH16 = "udh16"
+	//sar_* TLVs, SMSC builds UDH itself
+	CONCAT_SAR = "sar"
+	//whole message in message_payload TLV of a single submit_sm, SMSC segments it itself
+	CONCAT_PAYLOAD = "payload"
+)
+
+// destinations with allocated references, the table is reset when exceeded
+const maxRefDestinations = 100000
+
+// concatenation links parts of a long message with the reference, 8-bit UDH is used unless mode is set
+type concatenation struct {
+	mode string
+	ref  uint16
+}
+
+// ieLen is the length of concatenation element with its identifier and length a part must leave room for,
+// in SAR mode SMSC may add a 16-bit one
+func (c concatenation) ieLen() int {
+	if c.mode == CONCAT_UDH16 || c.mode == CONCAT_SAR {
+		return 6
+	}
+	return 5
+}
+
+// ie returns concatenation element of the part, nil in SAR mode
+func (c concatenation) ie(count, partNo int) []byte {
+	switch c.mode {
+	case CONCAT_SAR:
+		return nil
+	case CONCAT_UDH16:
+		return []byte{ieConcat16, 4, byte(c.ref >> 8), byte(c.ref), byte(count), byte(partNo)}
+	}
+	return []byte{ieConcat8, 3, byte(c.ref), byte(count), byte(partNo)}
+}
+
+// tlvs returns sar_* TLVs of the part in SAR mode
+func (c concatenation) tlvs(count, partNo int) map[uint16][]byte {
+	if c.mode != CONCAT_SAR || count < 2 {
+		return nil
+	}
+	ref := make([]byte, 2)
+	binary.BigEndian.PutUint16(ref, c.ref)
+	return map[uint16][]byte{
+		smpp.SAR_MSG_REF_NUM:    ref,
+		smpp.SAR_TOTAL_SEGMENTS: {byte(count)},
+		smpp.SAR_SEGMENT_SEQNUM: {byte(partNo)},
+	}
+}
+
+// withUdh prefixes every part with user data header made of the concatenation element and the other elements
+func (c concatenation) withUdh(parts [][]byte, elements []byte) [][]byte {
+	for i, part := range parts {
+		udh := c.ie(len(parts), i+1)
+		if len(parts) == 1 {
+			udh = nil
+		}
+		udh = append(udh, elements...)
+		if len(udh) > 0 {
+			parts[i] = append(append([]byte{byte(len(udh))}, udh...), part...)
+		}
+	}
+	return parts
+}
+
+// nextRef allocates concatenation reference for the destination: references of the same destination are sequential,
+// so messages to a handset do not share one until the reference wraps around
+func (c *smppClient) nextRef(phone string) uint16 {
+	c.refsMu.Lock()
+	defer c.refsMu.Unlock()
+
+	ref, ok := c.refs[phone]
+	if ok {
+		ref++
+	} else {
+		//new destinations start at random to survive restarts
+		b := make([]byte, 2)
+		_, err := rand.Read(b)
+		if err != nil {
+			zap.L().Warn("Error generating concatenation reference", zap.Error(err))
+		}
+		ref = binary.BigEndian.Uint16(b)
+	}
+
+	if c.refs == nil || len(c.refs) >= maxRefDestinations {
+		c.refs = make(map[string]uint16)
+	}
+	c.refs[phone] = ref
+
+	if c.concatMode == CONCAT_UDH16 || c.concatMode == CONCAT_SAR {
+		return ref
+	}
+	return ref & 0xFF
+}
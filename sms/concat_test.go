@@ -0,0 +1,60 @@
+package sms
+
+import (
+	"testing"
+
+	smpp "github.com/Dilshat/smpp34"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcatenation_withUdh(t *testing.T) {
+	port := portIe(9200, 2948)
+
+	//single part carries other elements only
+	parts := concatenation{mode: CONCAT_UDH8, ref: 7}.withUdh([][]byte{{1}}, port)
+
+	require.Equal(t, [][]byte{{6, iePort16, 4, 0x0B, 0x84, 0x23, 0xF0, 1}}, parts)
+
+	//concatenation with ports
+	parts = concatenation{mode: CONCAT_UDH8, ref: 7}.withUdh([][]byte{{1}, {2}}, port)
+
+	require.Equal(t, []byte{11, ieConcat8, 3, 7, 2, 1, iePort16, 4, 0x0B, 0x84, 0x23, 0xF0, 1}, parts[0])
+	require.Equal(t, []byte{11, ieConcat8, 3, 7, 2, 2, iePort16, 4, 0x0B, 0x84, 0x23, 0xF0, 2}, parts[1])
+
+	//16-bit reference
+	parts = concatenation{mode: CONCAT_UDH16, ref: 0x1234}.withUdh([][]byte{{1}, {2}}, nil)
+
+	require.Equal(t, []byte{6, ieConcat16, 4, 0x12, 0x34, 2, 1, 1}, parts[0])
+
+	//SMSC links parts in SAR mode
+	parts = concatenation{mode: CONCAT_SAR, ref: 0x1234}.withUdh([][]byte{{1}, {2}}, nil)
+
+	require.Equal(t, [][]byte{{1}, {2}}, parts)
+}
+
+func TestConcatenation_tlvs(t *testing.T) {
+	tlvs := concatenation{mode: CONCAT_SAR, ref: 0x1234}.tlvs(3, 2)
+
+	require.Equal(t, []byte{0x12, 0x34}, tlvs[smpp.SAR_MSG_REF_NUM])
+	require.Equal(t, []byte{3}, tlvs[smpp.SAR_TOTAL_SEGMENTS])
+	require.Equal(t, []byte{2}, tlvs[smpp.SAR_SEGMENT_SEQNUM])
+
+	require.Nil(t, concatenation{mode: CONCAT_SAR}.tlvs(1, 1))
+	require.Nil(t, concatenation{mode: CONCAT_UDH8}.tlvs(3, 2))
+}
+
+func TestSmppClient_nextRef(t *testing.T) {
+	c := smppClient{concatMode: CONCAT_UDH16}
+
+	first := c.nextRef(PHONE)
+
+	//references of a destination are sequential
+	require.Equal(t, first+1, c.nextRef(PHONE))
+	require.Equal(t, first+2, c.nextRef(PHONE))
+
+	//8-bit references wrap around within a byte
+	c = smppClient{concatMode: CONCAT_UDH8, refs: map[string]uint16{PHONE: 0xFF}}
+
+	require.Equal(t, uint16(0), c.nextRef(PHONE))
+	require.True(t, c.nextRef(SENDER) <= 0xFF)
+}
@@ -0,0 +1,97 @@
+package sms
+
+const (
+	//escape to the GSM 03.38 extension table
+	gsmEscape byte = 0x1B
+)
+
+var (
+	//GSM 03.38 default alphabet, position of a character is its septet code
+	gsmAlphabet = []rune("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+	//GSM 03.38 extension table, every character takes two septets (escape + code)
+	gsmExtension = map[rune]byte{
+		'\f': 0x0A,
+		'^':  0x14,
+		'{':  0x28,
+		'}':  0x29,
+		'\\': 0x2F,
+		'[':  0x3C,
+		'~':  0x3D,
+		']':  0x3E,
+		'|':  0x40,
+		'€':  0x65,
+	}
+
+	gsmExtensionCodes = func() map[byte]rune {
+		codes := make(map[byte]rune, len(gsmExtension))
+		for r, code := range gsmExtension {
+			codes[code] = r
+		}
+		return codes
+	}()
+
+	gsmBasic = func() map[rune]byte {
+		basic := make(map[rune]byte, len(gsmAlphabet))
+		for code, r := range gsmAlphabet {
+			if byte(code) != gsmEscape {
+				basic[r] = byte(code)
+			}
+		}
+		return basic
+	}()
+)
+
+// isGsm7 checks if text can be sent in GSM 03.38 default alphabet
+func isGsm7(text string) bool {
+	for _, r := range text {
+		if _, ok := gsmBasic[r]; ok {
+			continue
+		}
+		if _, ok := gsmExtension[r]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeGsm7 encodes text into unpacked GSM 03.38 septets (one septet per octet),
+// so the length of the result is the length of the text in septets.
+// Returns false if text contains characters outside of GSM 03.38
+func encodeGsm7(text string) ([]byte, bool) {
+	septets := make([]byte, 0, len(text))
+	for _, r := range text {
+		if code, ok := gsmBasic[r]; ok {
+			septets = append(septets, code)
+		} else if code, ok := gsmExtension[r]; ok {
+			septets = append(septets, gsmEscape, code)
+		} else {
+			return nil, false
+		}
+	}
+	return septets, true
+}
+
+// decodeGsm7 decodes unpacked GSM 03.38 septets (one septet per octet) into text,
+// unknown extension codes are decoded as space as recommended by GSM 03.38
+func decodeGsm7(septets []byte) string {
+	runes := make([]rune, 0, len(septets))
+	for i := 0; i < len(septets); i++ {
+		code := septets[i] & 0x7F
+		if code != gsmEscape {
+			runes = append(runes, gsmAlphabet[code])
+			continue
+		}
+		if i+1 == len(septets) {
+			break
+		}
+		i++
+		if r, ok := gsmExtensionCodes[septets[i]&0x7F]; ok {
+			runes = append(runes, r)
+		} else {
+			runes = append(runes, ' ')
+		}
+	}
+	return string(runes)
+}
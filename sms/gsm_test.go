@@ -0,0 +1,51 @@
+package sms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGsmAlphabet(t *testing.T) {
+	require.Equal(t, 128, len(gsmAlphabet))
+	require.Equal(t, 127, len(gsmBasic))
+}
+
+func TestIsGsm7(t *testing.T) {
+	require.True(t, isGsm7("Hello World!"))
+	require.True(t, isGsm7("Price: 5€, 3£, café, niño"))
+	require.True(t, isGsm7("{}[]~\\|^"))
+	require.False(t, isGsm7("`quoted`"))
+	require.False(t, isGsm7("Привет"))
+}
+
+func TestEncodeGsm7(t *testing.T) {
+	septets, ok := encodeGsm7("@a$")
+
+	require.True(t, ok)
+	require.Equal(t, []byte{0x00, 0x61, 0x02}, septets)
+
+	septets, ok = encodeGsm7("é€")
+
+	require.True(t, ok)
+	require.Equal(t, []byte{0x05, gsmEscape, 0x65}, septets)
+
+	septets, ok = encodeGsm7("{}[]~\\|^")
+
+	require.True(t, ok)
+	require.Equal(t, 16, len(septets))
+
+	_, ok = encodeGsm7("`")
+
+	require.False(t, ok)
+}
+
+func TestDecodeGsm7(t *testing.T) {
+	require.Equal(t, "@a$", decodeGsm7([]byte{0x00, 0x61, 0x02}))
+
+	septets, _ := encodeGsm7("Price: 5€, {café}")
+	require.Equal(t, "Price: 5€, {café}", decodeGsm7(septets))
+
+	//unknown extension code and dangling escape
+	require.Equal(t, "a b", decodeGsm7([]byte{0x61, gsmEscape, 0x01, 0x62, gsmEscape}))
+}
@@ -0,0 +1,135 @@
+package sms
+
+import (
+	"encoding/hex"
+
+	smpp "github.com/Dilshat/smpp34"
+	"github.com/Dilshat/smpp34/gsmutil"
+	"go.uber.org/zap"
+)
+
+const (
+	//message type bits of esm_class, zero for mobile originated messages, non-zero for receipts and acknowledgements
+	esmClassMessageTypeMask uint8 = 0x3C
+	//esm_class bit indicating that short_message starts with user data header
+	esmClassUdhi uint8 = 0x40
+
+	dataCodingDefault uint8 = 0x00
+	dataCodingIA5     uint8 = 0x01
+	dataCodingBinary  uint8 = 0x02
+	dataCodingLatin1  uint8 = 0x03
+	dataCodingOctet   uint8 = 0x04
+	dataCodingUcs2    uint8 = 0x08
+	//data coding / message class group, bit 2 selects 8-bit data
+	dataCodingClassGroup uint8 = 0xF0
+)
+
+// InboundMessage is a mobile originated message received from SMSC
+type InboundMessage struct {
+	Source      string
+	Destination string
+	Text        string
+	//Partial is set if some parts of a concatenated message were not received in time
+	Partial bool
+	//Route is the name of SMSC connection the message is received from, it is set by Sender
+	Route string
+}
+
+// isReceipt checks if deliver_sm with the esm_class carries a receipt rather than a message
+func isReceipt(esmClass uint8) bool {
+	return esmClass&esmClassMessageTypeMask != 0
+}
+
+func (c *smppClient) processInbound(pdu smpp.Pdu) {
+	msg := InboundMessage{
+		Source:      pdu.GetField(smpp.SOURCE_ADDR).String(),
+		Destination: pdu.GetField(smpp.DESTINATION_ADDR).String(),
+	}
+	dataCoding := fieldUint8(pdu, smpp.DATA_CODING)
+	data := []byte(pdu.GetField(smpp.SHORT_MESSAGE).String())
+
+	//parts of concatenated messages are identified either by UDH or by SAR TLVs
+	info, concatenated := sarInfo(pdu)
+	if fieldUint8(pdu, smpp.ESM_CLASS)&esmClassUdhi != 0 {
+		var udhInfo concatInfo
+		var isUdhPart bool
+		udhInfo, isUdhPart, data = splitUdh(data)
+		if isUdhPart {
+			info, concatenated = udhInfo, true
+		}
+	}
+
+	if concatenated {
+		var complete bool
+		msg, complete = c.inbound.add(msg, dataCoding, info, data)
+		if !complete {
+			return
+		}
+	} else {
+		msg.Text = decodeShortMessage(dataCoding, data)
+	}
+
+	c.deliverInbound(msg)
+}
+
+func (c *smppClient) deliverInbound(msg InboundMessage) {
+	if c.inboundHandler != nil {
+		go c.inboundHandler(msg)
+	}
+
+	zap.L().Debug("Inbound message", zap.String("source", msg.Source), zap.String("destination", msg.Destination), zap.Bool("partial", msg.Partial))
+}
+
+// decodeShortMessage decodes short_message according to data_coding,
+// binary data is returned hex encoded
+func decodeShortMessage(dataCoding uint8, data []byte) string {
+	if dataCoding&dataCodingClassGroup == dataCodingClassGroup {
+		if dataCoding&0x04 != 0 {
+			return hex.EncodeToString(data)
+		}
+		return decodeGsm7(data)
+	}
+
+	switch dataCoding {
+	case dataCodingDefault:
+		return decodeGsm7(data)
+	case dataCodingIA5:
+		return string(data)
+	case dataCodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case dataCodingUcs2:
+		text, err := gsmutil.DecodeUcs2(data)
+		if err != nil {
+			zap.L().Warn("Error decoding UCS-2 message", zap.Error(err))
+			return hex.EncodeToString(data)
+		}
+		return text
+	case dataCodingBinary, dataCodingOctet:
+		return hex.EncodeToString(data)
+	default:
+		return string(data)
+	}
+}
+
+// tlvValue returns value of the TLV with the tag
+func tlvValue(pdu smpp.Pdu, tag uint16) ([]byte, bool) {
+	tlv, ok := pdu.TLVFields()[tag]
+	if !ok || tlv == nil {
+		return nil, false
+	}
+	return tlv.Value(), true
+}
+
+// fieldUint8 returns value of a single octet field, 0 if the field is missing
+func fieldUint8(pdu smpp.Pdu, name string) uint8 {
+	field := pdu.GetField(name)
+	if field == nil {
+		return 0
+	}
+	value, _ := field.Value().(uint8)
+	return value
+}
@@ -0,0 +1,28 @@
+package sms
+
+import (
+	"testing"
+
+	"github.com/Dilshat/smpp34/gsmutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReceipt(t *testing.T) {
+	require.True(t, isReceipt(0x04))
+	require.True(t, isReceipt(0x20))
+	require.False(t, isReceipt(0x00))
+	//UDHI does not make a receipt
+	require.False(t, isReceipt(0x40))
+}
+
+func TestDecodeShortMessage(t *testing.T) {
+	septets, _ := encodeGsm7("Hi €")
+	require.Equal(t, "Hi €", decodeShortMessage(dataCodingDefault, septets))
+	require.Equal(t, "Hi", decodeShortMessage(dataCodingIA5, []byte("Hi")))
+	require.Equal(t, "café", decodeShortMessage(dataCodingLatin1, []byte{'c', 'a', 'f', 0xE9}))
+	require.Equal(t, "Привет", decodeShortMessage(dataCodingUcs2, gsmutil.EncodeUcs2("Привет")))
+	require.Equal(t, "0102ff", decodeShortMessage(dataCodingOctet, []byte{0x01, 0x02, 0xFF}))
+	//message class group
+	require.Equal(t, "0102", decodeShortMessage(0xF4, []byte{0x01, 0x02}))
+	require.Equal(t, "@", decodeShortMessage(0xF0, []byte{0x00}))
+}
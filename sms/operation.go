@@ -0,0 +1,115 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	smpp "github.com/Dilshat/smpp34"
+	"github.com/Dilshat/smpp34/gsmutil"
+)
+
+func (c *smppClient) CancelMessage(from, phone, smscId string) error {
+	_, err := c.operation(func(seq uint32) error {
+		return c.transceiver.CancelSm(seq, smscId, c.source(from), phone)
+	})
+	return err
+}
+
+func (c *smppClient) ReplaceMessage(from, smscId, originalText, text string) error {
+	//replace_sm has no data_coding, the original one is kept by SMSC
+	var textBytes []byte
+	maxLength := 160
+	if _, isGsm := encodeGsm7(originalText); isGsm {
+		var ok bool
+		textBytes, ok = encodeGsm7(text)
+		if !ok {
+			return errors.New("Replacement text must be in GSM 03.38 alphabet as the original one")
+		}
+	} else {
+		textBytes = gsmutil.EncodeUcs2(text)
+		maxLength = 140
+	}
+	if len(textBytes) > maxLength {
+		return errors.New("Replacement text does not fit one part")
+	}
+
+	_, err := c.operation(func(seq uint32) error {
+		return c.transceiver.ReplaceSm(seq, smscId, c.source(from), textBytes)
+	})
+	return err
+}
+
+func (c *smppClient) QueryMessage(from, smscId string) (Receipt, error) {
+	resp, err := c.operation(func(seq uint32) error {
+		return c.transceiver.QuerySm(seq, smscId, c.source(from))
+	})
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	raw, ok := resp.(*rawPdu)
+	if !ok {
+		return Receipt{}, errors.New("Unexpected response to query_sm")
+	}
+	receipt, ok := parseQuerySmResp(raw.body)
+	if !ok {
+		return Receipt{}, errors.New("Invalid query_sm_resp")
+	}
+	return receipt, nil
+}
+
+// operation sends the request with a new sequence number and waits for its response,
+// the response is returned only if its status is ESME_ROK
+func (c *smppClient) operation(send func(seq uint32) error) (smpp.Pdu, error) {
+	if !c.IsConnected() {
+		return nil, errors.New("Not connected to SMSC")
+	}
+
+	//impose tps limit
+	c.rateLimiter.Wait(context.Background())
+
+	seq := c.transceiver.NextSeq()
+	resp := make(chan smpp.Pdu, 1)
+	c.operationsMu.Lock()
+	if c.operations == nil {
+		c.operations = make(map[uint32]chan smpp.Pdu)
+	}
+	c.operations[seq] = resp
+	c.operationsMu.Unlock()
+
+	defer func() {
+		c.operationsMu.Lock()
+		delete(c.operations, seq)
+		c.operationsMu.Unlock()
+	}()
+
+	err := send(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case pdu := <-resp:
+		if status := pdu.GetHeader().Status; status != smpp.ESME_ROK {
+			return nil, status
+		}
+		return pdu, nil
+	case <-time.After(operationTimeout):
+		return nil, errors.New("No response from SMSC")
+	}
+}
+
+// completeOperation passes the response to the operation awaiting it,
+// returns false if there is no operation with the sequence number of the response
+func (c *smppClient) completeOperation(pdu smpp.Pdu) bool {
+	c.operationsMu.Lock()
+	defer c.operationsMu.Unlock()
+
+	resp, ok := c.operations[pdu.GetHeader().Sequence]
+	if ok {
+		delete(c.operations, pdu.GetHeader().Sequence)
+		resp <- pdu
+	}
+	return ok
+}
@@ -0,0 +1,96 @@
+package sms
+
+import (
+	"testing"
+
+	"github.com/Dilshat/smpp34"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestSmppClient_CancelMessage(t *testing.T) {
+	smppClnt := &smppClient{connected: 1, rateLimiter: rate.NewLimiter(rate.Inf, 1)}
+	status := smpp34.ESME_ROK
+	smppClnt.transceiver = transceiverWrapperMock{respond: func(seq uint32) {
+		//response may come before the operation starts waiting
+		smppClnt.completeOperation(mockPdu{header: &smpp34.Header{Id: smpp34.CANCEL_SM_RESP, Sequence: seq, Status: status}})
+	}}
+
+	err := smppClnt.CancelMessage(SENDER, PHONE, "1203837180")
+
+	require.NoError(t, err)
+	require.Empty(t, smppClnt.operations)
+
+	status = smpp34.ESME_RCANCELFAIL
+
+	err = smppClnt.CancelMessage(SENDER, PHONE, "1203837180")
+
+	require.Equal(t, smpp34.ESME_RCANCELFAIL, err)
+
+	//not connected
+	smppClnt.connected = 0
+
+	err = smppClnt.CancelMessage(SENDER, PHONE, "1203837180")
+
+	require.Error(t, err)
+}
+
+func TestSmppClient_ReplaceMessage(t *testing.T) {
+	smppClnt := &smppClient{connected: 1, rateLimiter: rate.NewLimiter(rate.Inf, 1)}
+	smppClnt.transceiver = transceiverWrapperMock{respond: func(seq uint32) {
+		smppClnt.completeOperation(mockPdu{header: &smpp34.Header{Id: smpp34.GENERIC_NACK, Sequence: seq}})
+	}}
+
+	err := smppClnt.ReplaceMessage(SENDER, "1203837180", "hello", "hi")
+
+	require.NoError(t, err)
+	require.Equal(t, []byte("hi"), replacedMessage)
+
+	//UCS2 original keeps UCS2 encoding
+	err = smppClnt.ReplaceMessage(SENDER, "1203837180", "привет", "hi")
+
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 'h', 0, 'i'}, replacedMessage)
+
+	//GSM original cannot be replaced with UCS2 text
+	err = smppClnt.ReplaceMessage(SENDER, "1203837180", "hello", "привет")
+
+	require.Error(t, err)
+
+	//text must fit one part
+	long := make([]byte, 161)
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	err = smppClnt.ReplaceMessage(SENDER, "1203837180", "hello", string(long))
+
+	require.Error(t, err)
+}
+
+func TestSmppClient_QueryMessage(t *testing.T) {
+	smppClnt := &smppClient{connected: 1, rateLimiter: rate.NewLimiter(rate.Inf, 1)}
+	body := []byte("1203837180\x00\x00\x02\x00")
+	smppClnt.transceiver = transceiverWrapperMock{respond: func(seq uint32) {
+		resp := newRawPdu(smpp34.QUERY_SM_RESP, seq, body)
+		smppClnt.completeOperation(resp)
+	}}
+
+	receipt, err := smppClnt.QueryMessage(SENDER, "1203837180")
+
+	require.NoError(t, err)
+	require.Equal(t, "1203837180", receipt.SmscId)
+	require.Equal(t, "DELIVRD", receipt.Status)
+
+	body = []byte("1203837180\x00")
+
+	_, err = smppClnt.QueryMessage(SENDER, "1203837180")
+
+	require.Error(t, err)
+}
+
+func TestSmppClient_completeOperation(t *testing.T) {
+	smppClnt := &smppClient{}
+
+	require.False(t, smppClnt.completeOperation(mockPdu{header: &smpp34.Header{Id: smpp34.CANCEL_SM_RESP, Sequence: SEQ}}))
+}
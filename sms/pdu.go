@@ -0,0 +1,158 @@
+package sms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	smpp "github.com/Dilshat/smpp34"
+)
+
+// rawPdu is a PDU not supported by smpp34, such as cancel_sm, replace_sm and query_sm
+// with their responses; the body is kept encoded
+type rawPdu struct {
+	*smpp.Header
+	body []byte
+}
+
+func newRawPdu(id smpp.CMDId, seq uint32, body []byte) *rawPdu {
+	return &rawPdu{Header: &smpp.Header{Id: id, Sequence: seq}, body: body}
+}
+
+// newCancelSm encodes cancel_sm of the message with smscId submitted from source to destinationAddr
+func newCancelSm(seq uint32, smscId string, source address, destinationAddr string) *rawPdu {
+	var body []byte
+	//service_type
+	body = appendCString(body, "")
+	body = appendCString(body, smscId)
+	body = appendAddress(body, source)
+	body = append(body, destAddrTon, destAddrNpi)
+	body = appendCString(body, destinationAddr)
+	return newRawPdu(smpp.CANCEL_SM, seq, body)
+}
+
+// newReplaceSm encodes replace_sm of the message with smscId submitted from source
+func newReplaceSm(seq uint32, smscId string, source address, shortMessage []byte) *rawPdu {
+	var body []byte
+	body = appendCString(body, smscId)
+	body = appendAddress(body, source)
+	//schedule_delivery_time and validity_period are left as they are
+	body = appendCString(body, "")
+	body = appendCString(body, "")
+	//registered_delivery, sm_default_msg_id, sm_length
+	body = append(body, 1, 0, byte(len(shortMessage)))
+	body = append(body, shortMessage...)
+	return newRawPdu(smpp.REPLACE_SM, seq, body)
+}
+
+// newQuerySm encodes query_sm of the message with smscId submitted from source
+func newQuerySm(seq uint32, smscId string, source address) *rawPdu {
+	var body []byte
+	body = appendCString(body, smscId)
+	body = appendAddress(body, source)
+	return newRawPdu(smpp.QUERY_SM, seq, body)
+}
+
+// parseQuerySmResp reads message_id, final_date, message_state and error_code of query_sm_resp
+func parseQuerySmResp(body []byte) (Receipt, bool) {
+	fields := bytes.SplitN(body, []byte{0}, 3)
+	if len(fields) < 3 || len(fields[2]) < 2 {
+		return Receipt{}, false
+	}
+
+	status, ok := messageStates[fields[2][0]]
+	if !ok {
+		return Receipt{}, false
+	}
+
+	return Receipt{
+		SmscId:    string(fields[0]),
+		Status:    status,
+		ErrorCode: fmt.Sprintf("%03d", fields[2][1]),
+		DoneDate:  parseSmppTime(string(fields[1])),
+	}, true
+}
+
+// parseSmppTime parses absolute time YYMMDDhhmmsstnnp, zero time is returned for empty, relative or invalid time
+func parseSmppTime(value string) time.Time {
+	if len(value) != 16 || (value[15] != '+' && value[15] != '-') {
+		return time.Time{}
+	}
+
+	//offset from UTC in quarters of an hour
+	quarters, err := strconv.Atoi(value[13:15])
+	if err != nil {
+		return time.Time{}
+	}
+	offset := quarters * 15 * 60
+	if value[15] == '-' {
+		offset = -offset
+	}
+
+	date, err := time.ParseInLocation("060102150405", value[:12], time.FixedZone("", offset))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// formatSmppTime formats the time as absolute time YYMMDDhhmmsstnnp in UTC
+func formatSmppTime(t time.Time) string {
+	return t.UTC().Format("060102150405") + "000+"
+}
+
+func appendCString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+// appendAddress appends TON, NPI and the address
+func appendAddress(b []byte, a address) []byte {
+	return appendCString(append(b, byte(a.ton), byte(a.npi)), a.addr)
+}
+
+func (p *rawPdu) Fields() map[string]smpp.Field {
+	return nil
+}
+
+func (p *rawPdu) MandatoryFieldsList() []string {
+	return nil
+}
+
+func (p *rawPdu) GetField(string) smpp.Field {
+	return nil
+}
+
+func (p *rawPdu) GetHeader() *smpp.Header {
+	return p.Header
+}
+
+func (p *rawPdu) TLVFields() map[uint16]*smpp.TLVField {
+	return nil
+}
+
+func (p *rawPdu) Writer() []byte {
+	b := make([]byte, 16, 16+len(p.body))
+	binary.BigEndian.PutUint32(b, uint32(16+len(p.body)))
+	binary.BigEndian.PutUint32(b[4:], uint32(p.Header.Id))
+	binary.BigEndian.PutUint32(b[8:], uint32(p.Header.Status))
+	binary.BigEndian.PutUint32(b[12:], p.Header.Sequence)
+	return append(b, p.body...)
+}
+
+func (p *rawPdu) SetField(f string, v interface{}) error {
+	return smpp.FieldValueErr
+}
+
+func (p *rawPdu) SetTLVField(t, l int, v []byte) error {
+	return smpp.TLVFieldPduErr
+}
+
+func (p *rawPdu) SetSeqNum(seq uint32) {
+	p.Header.Sequence = seq
+}
+
+func (p *rawPdu) Ok() bool {
+	return p.Header.Status == smpp.ESME_ROK
+}
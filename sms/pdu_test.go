@@ -0,0 +1,91 @@
+package sms
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dilshat/smpp34"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCancelSm(t *testing.T) {
+	pdu := newCancelSm(SEQ, "ab", address{addr: "s", ton: tonAlphanumeric}, "d")
+
+	require.Equal(t, []byte{
+		0, 0, 0, 28, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 1,
+		0, 'a', 'b', 0, tonAlphanumeric, npiUnknown, 's', 0, destAddrTon, destAddrNpi, 'd', 0,
+	}, pdu.Writer())
+}
+
+func TestNewReplaceSm(t *testing.T) {
+	pdu := newReplaceSm(SEQ, "ab", address{addr: "s", ton: tonAlphanumeric}, []byte("hi"))
+
+	require.Equal(t, []byte{
+		0, 0, 0, 30, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 1,
+		'a', 'b', 0, tonAlphanumeric, npiUnknown, 's', 0, 0, 0, 1, 0, 2, 'h', 'i',
+	}, pdu.Writer())
+}
+
+func TestReadPdu_raw(t *testing.T) {
+	client, smsc := net.Pipe()
+	defer client.Close()
+	defer smsc.Close()
+
+	go func() {
+		resp := newRawPdu(smpp34.CANCEL_SM_RESP, SEQ, nil)
+		resp.Header.Status = smpp34.ESME_RCANCELFAIL
+		_, _ = smsc.Write(resp.Writer())
+	}()
+
+	pdu, header, err := ReadPdu(client)
+
+	require.NoError(t, err)
+	require.Equal(t, smpp34.CANCEL_SM_RESP, header.Id)
+	require.Equal(t, SEQ, pdu.GetHeader().Sequence)
+	require.False(t, pdu.Ok())
+}
+
+func TestNewQuerySm(t *testing.T) {
+	pdu := newQuerySm(SEQ, "ab", address{addr: "s", ton: tonAlphanumeric})
+
+	require.Equal(t, []byte{
+		0, 0, 0, 23, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 1,
+		'a', 'b', 0, tonAlphanumeric, npiUnknown, 's', 0,
+	}, pdu.Writer())
+}
+
+func TestParseQuerySmResp(t *testing.T) {
+	receipt, ok := parseQuerySmResp([]byte("ab\x00200402113306000+\x00\x05\x22"))
+
+	require.True(t, ok)
+	require.Equal(t, "ab", receipt.SmscId)
+	require.Equal(t, "UNDELIV", receipt.Status)
+	require.Equal(t, "034", receipt.ErrorCode)
+	require.True(t, time.Date(2020, 4, 2, 11, 33, 6, 0, time.UTC).Equal(receipt.DoneDate))
+
+	//unknown state
+	_, ok = parseQuerySmResp([]byte("ab\x00\x00\x09\x00"))
+
+	require.False(t, ok)
+
+	_, ok = parseQuerySmResp([]byte("ab\x00"))
+
+	require.False(t, ok)
+}
+
+func TestParseSmppTime(t *testing.T) {
+	require.True(t, time.Date(2020, 4, 2, 11, 33, 6, 0, time.FixedZone("", 6*3600)).Equal(parseSmppTime("200402113306024+")))
+	require.True(t, time.Date(2020, 4, 2, 11, 33, 6, 0, time.FixedZone("", -3*3600)).Equal(parseSmppTime("200402113306012-")))
+
+	//relative time
+	require.True(t, parseSmppTime("000001000000000R").IsZero())
+	require.True(t, parseSmppTime("").IsZero())
+}
+
+func TestFormatSmppTime(t *testing.T) {
+	date := time.Date(2020, 4, 2, 11, 33, 6, 0, time.FixedZone("", 6*3600))
+
+	require.Equal(t, "200402053306000+", formatSmppTime(date))
+	require.True(t, date.Equal(parseSmppTime(formatSmppTime(date))))
+}
@@ -0,0 +1,160 @@
+package sms
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	smpp "github.com/Dilshat/smpp34"
+)
+
+const (
+	//time to wait for missing parts of a concatenated inbound message
+	inboundPartsTimeout = time.Minute * 5
+
+	//UDH information elements of concatenated messages
+	ieConcat8  byte = 0x00
+	ieConcat16 byte = 0x08
+)
+
+// concatInfo identifies a part of a concatenated message
+type concatInfo struct {
+	//kind is CONCAT_UDH8, CONCAT_UDH16 or CONCAT_SAR, references of different kinds are unrelated
+	kind  string
+	ref   uint16
+	total int
+	seqNo int
+}
+
+// valid reports whether the part belongs to a message of several parts and its number is within them
+func (i concatInfo) valid() bool {
+	return i.total > 1 && i.seqNo >= 1 && i.seqNo <= i.total
+}
+
+type reassemblyKey struct {
+	source string
+	kind   string
+	ref    uint16
+	total  int
+}
+
+// pendingInbound is a concatenated message awaiting its parts
+type pendingInbound struct {
+	msg        InboundMessage
+	dataCoding uint8
+	total      int
+	parts      map[int][]byte
+	firstAt    time.Time
+}
+
+// reassembler buffers parts of concatenated inbound messages by source and reference
+type reassembler struct {
+	mu      sync.Mutex
+	pending map[reassemblyKey]*pendingInbound
+}
+
+// splitUdh parses concatenation info from the user data header and returns the data without the header
+func splitUdh(data []byte) (concatInfo, bool, []byte) {
+	if len(data) == 0 || int(data[0])+1 > len(data) {
+		return concatInfo{}, false, data
+	}
+
+	udh := data[1 : data[0]+1]
+	payload := data[data[0]+1:]
+	for len(udh) >= 2 {
+		ie, length := udh[0], int(udh[1])
+		if len(udh) < 2+length {
+			break
+		}
+		value := udh[2 : 2+length]
+		switch {
+		case ie == ieConcat8 && length == 3:
+			return concatInfo{kind: CONCAT_UDH8, ref: uint16(value[0]), total: int(value[1]), seqNo: int(value[2])}, true, payload
+		case ie == ieConcat16 && length == 4:
+			return concatInfo{kind: CONCAT_UDH16, ref: binary.BigEndian.Uint16(value), total: int(value[2]), seqNo: int(value[3])}, true, payload
+		}
+		udh = udh[2+length:]
+	}
+
+	return concatInfo{}, false, payload
+}
+
+// sarInfo reads concatenation info from SAR TLVs
+func sarInfo(pdu smpp.Pdu) (concatInfo, bool) {
+	ref, ok1 := tlvValue(pdu, smpp.SAR_MSG_REF_NUM)
+	total, ok2 := tlvValue(pdu, smpp.SAR_TOTAL_SEGMENTS)
+	seqNo, ok3 := tlvValue(pdu, smpp.SAR_SEGMENT_SEQNUM)
+	if !ok1 || !ok2 || !ok3 || len(ref) != 2 || len(total) != 1 || len(seqNo) != 1 {
+		return concatInfo{}, false
+	}
+
+	return concatInfo{kind: CONCAT_SAR, ref: binary.BigEndian.Uint16(ref), total: int(total[0]), seqNo: int(seqNo[0])}, true
+}
+
+// add buffers the part and returns the whole message once all its parts are received,
+// a part with invalid concatenation info is returned right away as a message of its own
+func (r *reassembler) add(msg InboundMessage, dataCoding uint8, info concatInfo, data []byte) (InboundMessage, bool) {
+	if !info.valid() {
+		msg.Text = decodeShortMessage(dataCoding, data)
+		return msg, true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == nil {
+		r.pending = make(map[reassemblyKey]*pendingInbound)
+	}
+
+	key := reassemblyKey{source: msg.Source, kind: info.kind, ref: info.ref, total: info.total}
+	pending, ok := r.pending[key]
+	if !ok {
+		pending = &pendingInbound{msg: msg, dataCoding: dataCoding, total: info.total, parts: make(map[int][]byte), firstAt: time.Now()}
+		r.pending[key] = pending
+	}
+	pending.parts[info.seqNo] = data
+
+	if len(pending.parts) < pending.total {
+		return InboundMessage{}, false
+	}
+
+	delete(r.pending, key)
+	return pending.assemble(), true
+}
+
+// expire removes messages waiting for their parts longer than inboundPartsTimeout
+// and returns them flagged as partial
+func (r *reassembler) expire(now time.Time) []InboundMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var expired []InboundMessage
+	for key, pending := range r.pending {
+		if now.Sub(pending.firstAt) >= inboundPartsTimeout {
+			delete(r.pending, key)
+			msg := pending.assemble()
+			msg.Partial = true
+			expired = append(expired, msg)
+		}
+	}
+	return expired
+}
+
+// assemble decodes received parts joined in order
+func (p *pendingInbound) assemble() InboundMessage {
+	seqNos := make([]int, 0, len(p.parts))
+	for seqNo := range p.parts {
+		seqNos = append(seqNos, seqNo)
+	}
+	sort.Ints(seqNos)
+
+	var data []byte
+	for _, seqNo := range seqNos {
+		data = append(data, p.parts[seqNo]...)
+	}
+
+	msg := p.msg
+	msg.Text = decodeShortMessage(p.dataCoding, data)
+	return msg
+}
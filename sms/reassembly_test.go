@@ -0,0 +1,144 @@
+package sms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dilshat/smpp34"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitUdh(t *testing.T) {
+	info, ok, data := splitUdh([]byte{5, 0, 3, 7, 2, 1, 'H', 'i'})
+
+	require.True(t, ok)
+	require.Equal(t, concatInfo{kind: CONCAT_UDH8, ref: 7, total: 2, seqNo: 1}, info)
+	require.Equal(t, []byte("Hi"), data)
+
+	//16-bit reference after an unrelated information element
+	info, ok, data = splitUdh([]byte{9, 0x24, 1, 1, 8, 4, 0x01, 0x02, 3, 2, 'H', 'i'})
+
+	require.True(t, ok)
+	require.Equal(t, concatInfo{kind: CONCAT_UDH16, ref: 0x0102, total: 3, seqNo: 2}, info)
+	require.Equal(t, []byte("Hi"), data)
+
+	//header without concatenation info is stripped anyway
+	_, ok, data = splitUdh([]byte{4, 0x05, 2, 0x0B, 0x84, 'H', 'i'})
+
+	require.False(t, ok)
+	require.Equal(t, []byte("Hi"), data)
+}
+
+func TestSarInfo(t *testing.T) {
+	pdu, _ := smpp34.NewDeliverSm(&smpp34.Header{Id: smpp34.DELIVER_SM}, []byte{})
+	_, ok := sarInfo(pdu)
+
+	require.False(t, ok)
+
+	_ = pdu.SetTLVField(smpp34.SAR_MSG_REF_NUM, 2, []byte{0x01, 0x02})
+	_ = pdu.SetTLVField(smpp34.SAR_TOTAL_SEGMENTS, 1, []byte{3})
+	_ = pdu.SetTLVField(smpp34.SAR_SEGMENT_SEQNUM, 1, []byte{2})
+	info, ok := sarInfo(pdu)
+
+	require.True(t, ok)
+	require.Equal(t, concatInfo{kind: CONCAT_SAR, ref: 0x0102, total: 3, seqNo: 2}, info)
+}
+
+func TestReassembler_add(t *testing.T) {
+	r := reassembler{}
+	msg := InboundMessage{Source: PHONE, Destination: SENDER}
+
+	_, complete := r.add(msg, dataCodingIA5, concatInfo{ref: 1, total: 3, seqNo: 3}, []byte("!"))
+	require.False(t, complete)
+	//same reference from another phone is another message
+	_, complete = r.add(InboundMessage{Source: SENDER}, dataCodingIA5, concatInfo{ref: 1, total: 2, seqNo: 1}, []byte("x"))
+	require.False(t, complete)
+	_, complete = r.add(msg, dataCodingIA5, concatInfo{ref: 1, total: 3, seqNo: 1}, []byte("Hello "))
+	require.False(t, complete)
+
+	whole, complete := r.add(msg, dataCodingIA5, concatInfo{ref: 1, total: 3, seqNo: 2}, []byte("world"))
+
+	require.True(t, complete)
+	require.Equal(t, "Hello world!", whole.Text)
+	require.Equal(t, PHONE, whole.Source)
+	require.False(t, whole.Partial)
+	require.Equal(t, 1, len(r.pending))
+}
+
+func TestReassembler_addInvalid(t *testing.T) {
+	r := reassembler{}
+	msg := InboundMessage{Source: PHONE}
+
+	//part number beyond the total is delivered as is
+	single, complete := r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_UDH8, ref: 1, total: 2, seqNo: 3}, []byte("three"))
+
+	require.True(t, complete)
+	require.Equal(t, "three", single.Text)
+
+	single, complete = r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_UDH8, ref: 1, total: 1, seqNo: 1}, []byte("one"))
+
+	require.True(t, complete)
+	require.Equal(t, "one", single.Text)
+	require.Equal(t, 0, len(r.pending))
+
+	//duplicate part does not complete the message
+	_, complete = r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_UDH8, ref: 1, total: 2, seqNo: 1}, []byte("a"))
+	require.False(t, complete)
+	_, complete = r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_UDH8, ref: 1, total: 2, seqNo: 1}, []byte("a"))
+	require.False(t, complete)
+
+	//parts with the same reference but another kind or total belong to other messages
+	_, complete = r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_UDH16, ref: 1, total: 2, seqNo: 2}, []byte("b"))
+	require.False(t, complete)
+	_, complete = r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_SAR, ref: 1, total: 2, seqNo: 2}, []byte("b"))
+	require.False(t, complete)
+	_, complete = r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_UDH8, ref: 1, total: 3, seqNo: 2}, []byte("b"))
+	require.False(t, complete)
+
+	whole, complete := r.add(msg, dataCodingIA5, concatInfo{kind: CONCAT_UDH8, ref: 1, total: 2, seqNo: 2}, []byte("b"))
+
+	require.True(t, complete)
+	require.Equal(t, "ab", whole.Text)
+	require.Equal(t, 3, len(r.pending))
+}
+
+func TestReassembler_expire(t *testing.T) {
+	r := reassembler{}
+	_, _ = r.add(InboundMessage{Source: PHONE}, dataCodingIA5, concatInfo{ref: 1, total: 3, seqNo: 3}, []byte("!"))
+	_, _ = r.add(InboundMessage{Source: PHONE}, dataCodingIA5, concatInfo{ref: 1, total: 3, seqNo: 1}, []byte("Hello"))
+
+	require.Equal(t, 0, len(r.expire(time.Now())))
+
+	expired := r.expire(time.Now().Add(inboundPartsTimeout))
+
+	require.Equal(t, 1, len(expired))
+	require.Equal(t, "Hello!", expired[0].Text)
+	require.True(t, expired[0].Partial)
+	require.Equal(t, 0, len(r.pending))
+}
+
+func TestSmppClient_processInboundConcatenated(t *testing.T) {
+	smppClnt := smppClient{}
+	inbound := make(chan InboundMessage, 1)
+	smppClnt.BindInboundHandler(func(msg InboundMessage) {
+		inbound <- msg
+	})
+
+	for _, part := range []string{"world", "Hello "} {
+		pdu, _ := smpp34.NewDeliverSm(&smpp34.Header{Id: smpp34.DELIVER_SM}, []byte{})
+		_ = pdu.SetField(smpp34.SOURCE_ADDR, PHONE)
+		_ = pdu.SetField(smpp34.ESM_CLASS, 0x40)
+		_ = pdu.SetField(smpp34.DATA_CODING, dataCodingIA5)
+		seqNo := byte(2)
+		if part == "Hello " {
+			seqNo = 1
+		}
+		_ = pdu.SetField(smpp34.SHORT_MESSAGE, string(append([]byte{5, 0, 3, 9, 2, seqNo}, part...)))
+
+		smppClnt.processInbound(pdu)
+	}
+
+	msg := <-inbound
+	require.Equal(t, "Hello world", msg.Text)
+	require.Equal(t, PHONE, msg.Source)
+}
@@ -0,0 +1,116 @@
+package sms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	smpp "github.com/Dilshat/smpp34"
+)
+
+var (
+	//fields of the receipt text, e.g. "id:123 sub:001 dlvrd:001 submit date:2004021133 done date:2004021134 stat:DELIVRD err:000 text:..."
+	receiptFieldRx = regexp.MustCompile(`(?i)(id|sub|dlvrd|submit date|done date|stat|err):(\S*)`)
+	//start of the original message text in the receipt
+	receiptTextRx = regexp.MustCompile(`(?i)\btext:`)
+
+	//message_state TLV values and corresponding receipt statuses
+	messageStates = map[uint8]string{
+		1: "ENROUTE",
+		2: "DELIVRD",
+		3: "EXPIRED",
+		4: "DELETED",
+		5: "UNDELIV",
+		6: "ACCEPTD",
+		7: "UNKNOWN",
+		8: "REJECTD",
+	}
+)
+
+// receiptDateLayouts are formats of submit and done dates, with and without seconds
+var receiptDateLayouts = map[int]string{
+	10: "0601021504",
+	12: "060102150405",
+}
+
+// Receipt is a delivery receipt of a submitted message
+type Receipt struct {
+	//SmscId is the message id assigned by SMSC on submit
+	SmscId string
+	//Status is the final or intermediate state of the message, e.g. DELIVRD or UNDELIV
+	Status string
+	//ErrorCode is the network specific error code, empty if not reported
+	ErrorCode string
+	//Submitted and Delivered are numbers of submitted and delivered short messages
+	Submitted int
+	Delivered int
+	//SubmitDate and DoneDate are zero if not reported
+	SubmitDate time.Time
+	DoneDate   time.Time
+}
+
+// parseReceipt reads receipt from TLVs falling back to the fields of the receipt text
+func parseReceipt(pdu smpp.Pdu) (Receipt, bool) {
+	receipt := parseReceiptText(pdu.GetField(smpp.SHORT_MESSAGE).String())
+
+	if value, ok := tlvValue(pdu, smpp.RECEIPTED_MESSAGE_ID); ok {
+		receipt.SmscId = strings.TrimRight(string(value), "\x00")
+	}
+	if value, ok := tlvValue(pdu, smpp.DR_MESSAGE_STATE); ok && len(value) == 1 {
+		if status, known := messageStates[value[0]]; known {
+			receipt.Status = status
+		}
+	}
+	if value, ok := tlvValue(pdu, smpp.NETWORK_ERROR_CODE); ok && len(value) == 3 {
+		//network type followed by 2 octets of error code
+		receipt.ErrorCode = fmt.Sprintf("%03d", binary.BigEndian.Uint16(value[1:]))
+	}
+
+	return receipt, receipt.SmscId != "" && receipt.Status != ""
+}
+
+// parseReceiptText reads fields of the receipt text described in appendix B of SMPP 3.4
+func parseReceiptText(text string) Receipt {
+	if loc := receiptTextRx.FindStringIndex(text); loc != nil {
+		//original text may contain anything
+		text = text[:loc[0]]
+	}
+
+	receipt := Receipt{}
+	for _, field := range receiptFieldRx.FindAllStringSubmatch(text, -1) {
+		value := field[2]
+		switch strings.ToLower(field[1]) {
+		case "id":
+			receipt.SmscId = value
+		case "sub":
+			_, _ = fmt.Sscan(value, &receipt.Submitted)
+		case "dlvrd":
+			_, _ = fmt.Sscan(value, &receipt.Delivered)
+		case "submit date":
+			receipt.SubmitDate = parseReceiptDate(value)
+		case "done date":
+			receipt.DoneDate = parseReceiptDate(value)
+		case "stat":
+			receipt.Status = strings.ToUpper(value)
+		case "err":
+			receipt.ErrorCode = value
+		}
+	}
+
+	return receipt
+}
+
+// parseReceiptDate parses YYMMDDhhmm[ss] in local time, zero time is returned for invalid dates
+func parseReceiptDate(value string) time.Time {
+	layout, ok := receiptDateLayouts[len(value)]
+	if !ok {
+		return time.Time{}
+	}
+	date, err := time.ParseInLocation(layout, value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
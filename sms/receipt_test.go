@@ -0,0 +1,51 @@
+package sms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dilshat/smpp34"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReceiptText(t *testing.T) {
+	receipt := parseReceiptText("id:1203837180 sub:001 dlvrd:000 submit date:1911251537 done date:191125153812 stat:UNDELIV err:034 text:stat:DELIVRD err:000")
+
+	require.Equal(t, "1203837180", receipt.SmscId)
+	require.Equal(t, 1, receipt.Submitted)
+	require.Equal(t, 0, receipt.Delivered)
+	require.Equal(t, time.Date(2019, 11, 25, 15, 37, 0, 0, time.Local), receipt.SubmitDate)
+	require.Equal(t, time.Date(2019, 11, 25, 15, 38, 12, 0, time.Local), receipt.DoneDate)
+	//fields of the original text are ignored
+	require.Equal(t, "UNDELIV", receipt.Status)
+	require.Equal(t, "034", receipt.ErrorCode)
+}
+
+func TestParseReceiptDate(t *testing.T) {
+	require.True(t, parseReceiptDate("").IsZero())
+	require.True(t, parseReceiptDate("1913251537").IsZero())
+	require.Equal(t, time.Date(2020, 4, 2, 11, 33, 0, 0, time.Local), parseReceiptDate("2004021133"))
+}
+
+func TestParseReceipt(t *testing.T) {
+	pdu, _ := smpp34.NewDeliverSm(&smpp34.Header{Id: smpp34.DELIVER_SM}, []byte{})
+	_ = pdu.SetField(smpp34.ESM_CLASS, 0x04)
+
+	_, ok := parseReceipt(pdu)
+
+	require.False(t, ok)
+
+	//TLVs are preferred over the text
+	_ = pdu.SetField(smpp34.SHORT_MESSAGE, "id:1 sub:001 dlvrd:001 submit date:2004021133 done date:2004021134 stat:DELIVRD err:000")
+	_ = pdu.SetTLVField(smpp34.RECEIPTED_MESSAGE_ID, 3, []byte("AB\x00"))
+	_ = pdu.SetTLVField(smpp34.DR_MESSAGE_STATE, 1, []byte{5})
+	_ = pdu.SetTLVField(smpp34.NETWORK_ERROR_CODE, 3, []byte{3, 0, 11})
+
+	receipt, ok := parseReceipt(pdu)
+
+	require.True(t, ok)
+	require.Equal(t, "AB", receipt.SmscId)
+	require.Equal(t, "UNDELIV", receipt.Status)
+	require.Equal(t, "011", receipt.ErrorCode)
+	require.Equal(t, time.Date(2020, 4, 2, 11, 34, 0, 0, time.Local), receipt.DoneDate)
+}
@@ -0,0 +1,105 @@
+package sms
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+type Route struct {
+	//Name identifies SMSC connection
+	Name   string
+	Client SmppClient
+	//Prefixes of phones served by this connection
+	Prefixes []string
+	//Backup is the name of the route used while this one is unavailable
+	Backup string
+}
+
+type Router interface {
+	//Route returns name of the route which serves the phone
+	Route(phone string) (string, error)
+	//Client returns SMPP client of the route with the given name
+	Client(name string) SmppClient
+	//Names returns names of all routes
+	Names() []string
+	//Backup returns name of the backup route of the route with the given name
+	Backup(name string) string
+}
+
+type prefixRule struct {
+	prefix string
+	route  string
+}
+
+type router struct {
+	clients      map[string]SmppClient
+	backups      map[string]string
+	names        []string
+	rules        []prefixRule
+	defaultRoute string
+}
+
+// NewRouter creates router over the given routes; phones matching no prefix
+// are sent via defaultRoute, empty defaultRoute disables the fallback
+func NewRouter(routes []Route, defaultRoute string) (Router, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("No SMSC routes configured")
+	}
+
+	r := &router{clients: make(map[string]SmppClient), backups: make(map[string]string), defaultRoute: defaultRoute}
+	for _, route := range routes {
+		if _, ok := r.clients[route.Name]; ok {
+			return nil, errors.New("Duplicate SMSC route " + route.Name)
+		}
+		r.clients[route.Name] = route.Client
+		r.backups[route.Name] = route.Backup
+		r.names = append(r.names, route.Name)
+		for _, prefix := range route.Prefixes {
+			r.rules = append(r.rules, prefixRule{prefix: prefix, route: route.Name})
+		}
+	}
+
+	if _, ok := r.clients[defaultRoute]; defaultRoute != "" && !ok {
+		return nil, errors.New("Unknown default SMSC route " + defaultRoute)
+	}
+
+	for name, backup := range r.backups {
+		if _, ok := r.clients[backup]; backup != "" && (!ok || backup == name) {
+			return nil, errors.New("Invalid backup SMSC route " + backup + " of " + name)
+		}
+	}
+
+	//longest prefix first so that the first match wins
+	sort.SliceStable(r.rules, func(i, j int) bool {
+		return len(r.rules[i].prefix) > len(r.rules[j].prefix)
+	})
+
+	return r, nil
+}
+
+func (r *router) Route(phone string) (string, error) {
+	for _, rule := range r.rules {
+		if strings.HasPrefix(phone, rule.prefix) {
+			return rule.route, nil
+		}
+	}
+
+	if r.defaultRoute == "" {
+		return "", errors.New("No SMSC route for phone " + phone)
+	}
+
+	return r.defaultRoute, nil
+}
+
+func (r *router) Client(name string) SmppClient {
+	return r.clients[name]
+}
+
+func (r *router) Names() []string {
+	return r.names
+}
+
+func (r *router) Backup(name string) string {
+	return r.backups[name]
+}
@@ -0,0 +1,86 @@
+package sms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ROUTE  = "default"
+	ROUTE2 = "operator"
+	ROUTE3 = "operator-subnet"
+)
+
+func TestNewRouter(t *testing.T) {
+	_, err := NewRouter(nil, "")
+
+	require.Error(t, err)
+
+	_, err = NewRouter([]Route{{Name: ROUTE}, {Name: ROUTE}}, "")
+
+	require.Error(t, err)
+
+	_, err = NewRouter([]Route{{Name: ROUTE}}, ROUTE2)
+
+	require.Error(t, err)
+
+	_, err = NewRouter([]Route{{Name: ROUTE, Backup: ROUTE2}}, ROUTE)
+
+	require.Error(t, err)
+
+	_, err = NewRouter([]Route{{Name: ROUTE, Backup: ROUTE}}, ROUTE)
+
+	require.Error(t, err)
+
+	router, err := NewRouter([]Route{{Name: ROUTE}, {Name: ROUTE2}}, ROUTE)
+
+	require.NoError(t, err)
+	require.Equal(t, []string{ROUTE, ROUTE2}, router.Names())
+}
+
+func TestRouter_Route(t *testing.T) {
+	router, _ := NewRouter([]Route{
+		{Name: ROUTE},
+		{Name: ROUTE2, Prefixes: []string{"99655", "99670"}},
+		{Name: ROUTE3, Prefixes: []string{"996551"}},
+	}, ROUTE)
+
+	route, err := router.Route("996551123456")
+
+	require.NoError(t, err)
+	require.Equal(t, ROUTE3, route)
+
+	route, _ = router.Route("996552123456")
+
+	require.Equal(t, ROUTE2, route)
+
+	route, _ = router.Route("996700123456")
+
+	require.Equal(t, ROUTE2, route)
+
+	route, _ = router.Route("996777123456")
+
+	require.Equal(t, ROUTE, route)
+
+	router, _ = NewRouter([]Route{{Name: ROUTE2, Prefixes: []string{"99655"}}}, "")
+
+	_, err = router.Route("996777123456")
+
+	require.Error(t, err)
+}
+
+func TestRouter_Backup(t *testing.T) {
+	router, _ := NewRouter([]Route{{Name: ROUTE, Backup: ROUTE2}, {Name: ROUTE2}}, ROUTE)
+
+	require.Equal(t, ROUTE2, router.Backup(ROUTE))
+	require.Equal(t, "", router.Backup(ROUTE2))
+}
+
+func TestRouter_Client(t *testing.T) {
+	client := &mockSmppClient{}
+	router, _ := NewRouter([]Route{{Name: ROUTE, Client: client}}, ROUTE)
+
+	require.Equal(t, client, router.Client(ROUTE))
+	require.Nil(t, router.Client(ROUTE2))
+}
@@ -2,79 +2,294 @@ package sms
 
 import (
 	"errors"
+	"sync"
 	"time"
 
-	"github.com/cskr/pubsub"
+	smpp "github.com/Dilshat/smpp34"
+	"github.com/dilshat/sms-sender/dao"
+	"github.com/dilshat/sms-sender/model"
 	"go.uber.org/zap"
 )
 
 const (
-	OUT = "out"
+	//number of failed attempts after which queued message is dropped
+	maxSendAttempts = 3
+	//number of consecutive submit failures after which route fails over to its backup
+	failoverThreshold = 5
+	//time during which failed route is bypassed before it is tried again
+	failoverCooldown = time.Second * 30
 )
 
-type sms struct {
-	Id     uint32
-	Sender string
-	Text   string
-	Phone  string
-}
+var (
+	//statuses other than transient ones that indicate failure of the bind rather than of the message,
+	//ESME_RSUBMITFAIL is also reported for submits without response
+	bindFailureStatuses = map[smpp.CMDStatus]bool{
+		smpp.ESME_RSUBMITFAIL: true,
+		smpp.ESME_RINVBNDSTS:  true,
+	}
+)
 
 type Response struct {
 }
 
 type Sender interface {
 	Start() error
-	Send(id uint32, sender, phone, text string) error
-	BindSubmitSmResponseHandler(handler func(id, status uint32, smscId string))
-	BindDeliverSmHandler(handler func(smscId string, status string))
+	//Send queues the message to the phone for submit with the given submit_sm options
+	Send(id uint32, sender, phone, text string, options model.SubmitOptions) error
+	//Route returns name of the route which serves the phone, error if there is none
+	Route(phone string) (string, error)
+	//ValidateSender checks if the sender can be sent as source address via the route and its backup
+	ValidateSender(route, sender string) error
+	//Queued reports whether message of the recipient is in the outgoing queue or awaits submit results
+	Queued(id uint32) (bool, error)
+	//Dequeue removes message of the recipient from the outgoing queue, false if it is not queued
+	Dequeue(id uint32) (bool, error)
+	//ReplaceQueued replaces text of the queued message of the recipient, false if it is not queued
+	ReplaceQueued(id uint32, text string) (bool, error)
+	//Cancel cancels the part submitted via the route with cancel_sm
+	Cancel(route, sender, phone, smscId string) error
+	//Replace replaces text of the message submitted via the route with replace_sm
+	Replace(route, sender, smscId, originalText, text string) error
+	//Query returns state of the part submitted via the route as a receipt, it is requested with query_sm
+	Query(route, sender, smscId string) (Receipt, error)
+	//BindSubmitSmResponseHandler binds handler of submit responses of every part of messages
+	BindSubmitSmResponseHandler(handler func(result SubmitResult))
+	BindDeliverSmHandler(handler func(receipt Receipt))
+	//BindInboundHandler binds handler of mobile originated messages received via all routes
+	BindInboundHandler(handler func(msg InboundMessage))
 }
 
 type sender struct {
-	smppClient SmppClient
-	ps         *pubsub.PubSub
-	out        chan interface{}
+	router          Router
+	outgoingDao     dao.OutgoingDao
+	submitSmHandler func(result SubmitResult)
+	//signal processOutgoing of the route that a new message has been queued
+	queued map[string]chan struct{}
+	//held while a message of the route is claimed for submit, so that it is not dequeued meanwhile
+	queueMu map[string]*sync.Mutex
+	health  map[string]*routeHealth
+	//serializes counting of submit results of parts
+	doneMu sync.Mutex
 }
 
-func NewSender(smppClient SmppClient) Sender {
-	ps := pubsub.New(100)
-	return &sender{smppClient: smppClient, ps: ps, out: ps.Sub(OUT)}
+// routeHealth tracks submit failures of the route
+type routeHealth struct {
+	mu             sync.Mutex
+	failures       int
+	suspendedUntil time.Time
 }
 
-func (s *sender) Start() error {
+func NewSender(router Router, outgoingDao dao.OutgoingDao) Sender {
+	queued := make(map[string]chan struct{})
+	queueMu := make(map[string]*sync.Mutex)
+	health := make(map[string]*routeHealth)
+	for _, name := range router.Names() {
+		queued[name] = make(chan struct{}, 1)
+		queueMu[name] = &sync.Mutex{}
+		health[name] = &routeHealth{}
+	}
+	return &sender{router: router, outgoingDao: outgoingDao, queued: queued, queueMu: queueMu, health: health}
+}
 
-	err := s.smppClient.Connect()
+func (s *sender) Start() error {
+	//messages submitted before restart may have no results recorded, they are sent again
+	err := s.outgoingDao.RequeueInFlight()
 	if err != nil {
+		zap.L().Error("Error requeueing in-flight messages", zap.Error(err))
+	}
+
+	connected := 0
+	for _, name := range s.router.Names() {
+		err = s.router.Client(name).Connect()
+		if err != nil {
+			//CheckConnection keeps reconnecting in the background
+			zap.L().Error("Error connecting to SMSC", zap.String("route", name), zap.Error(err))
+		} else {
+			connected++
+		}
+	}
+	if connected == 0 {
 		return err
 	}
 
-	go s.ReadPackets()
-	go s.CheckConnection()
-	go s.processOutgoing()
+	for _, name := range s.router.Names() {
+		client := s.router.Client(name)
+		go s.ReadPackets(client)
+		go s.CheckConnection(client)
+		go s.processOutgoing(name)
+	}
 
 	return nil
 }
 
-func (s *sender) BindSubmitSmResponseHandler(handler func(id, status uint32, smscId string)) {
-	s.smppClient.BindSubmitSmResponseHandler(handler)
+func (s *sender) BindSubmitSmResponseHandler(handler func(result SubmitResult)) {
+	s.submitSmHandler = handler
+	for _, name := range s.router.Names() {
+		route := name
+		s.router.Client(name).BindSubmitSmResponseHandler(func(result SubmitResult) {
+			//only final results count for health of the route
+			if !result.Retry {
+				s.health[route].record(result.Status)
+			}
+			result.Route = route
+			handler(result)
+			//the message leaves the queue once results of all its parts are recorded
+			if !result.Retry {
+				s.completePart(result)
+			}
+		})
+	}
 }
 
-func (s *sender) BindDeliverSmHandler(handler func(smscId string, status string)) {
-	s.smppClient.BindDeliverSmHandler(handler)
+func (s *sender) BindDeliverSmHandler(handler func(receipt Receipt)) {
+	for _, name := range s.router.Names() {
+		s.router.Client(name).BindDeliverSmHandler(handler)
+	}
 }
 
-func (s *sender) Send(id uint32, sender, phone, text string) error {
-	if !s.smppClient.IsConnected() {
-		return errors.New("Not connected to SMSC")
+func (s *sender) BindInboundHandler(handler func(msg InboundMessage)) {
+	for _, name := range s.router.Names() {
+		route := name
+		s.router.Client(name).BindInboundHandler(func(msg InboundMessage) {
+			msg.Route = route
+			handler(msg)
+		})
 	}
+}
+
+func (s *sender) Send(id uint32, sender, phone, text string, options model.SubmitOptions) error {
+	route, err := s.router.Route(phone)
+	if err != nil {
+		return err
+	}
+
+	//messages queued while SMSC is disconnected are sent after reconnect
+	_, err = s.outgoingDao.Push(id, route, sender, phone, text, options)
+	if err != nil {
+		return err
+	}
+
+	//wake up processOutgoing, no-op if it is already signalled
+	select {
+	case s.queued[route] <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
 
-	s.ps.Pub(sms{Id: id, Sender: sender, Phone: phone, Text: text}, OUT)
+func (s *sender) Route(phone string) (string, error) {
+	return s.router.Route(phone)
+}
 
+func (s *sender) ValidateSender(route, sender string) error {
+	for _, name := range []string{route, s.router.Backup(route)} {
+		if name == "" {
+			continue
+		}
+		client := s.router.Client(name)
+		if client == nil {
+			return errors.New("Unknown SMSC route " + name)
+		}
+		err := client.ValidateSender(sender)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
-func (s *sender) ReadPackets() {
+
+func (s *sender) Queued(id uint32) (bool, error) {
+	_, err := s.outgoingDao.GetByRecipientId(id)
+	if err != nil {
+		if err.Error() == "not found" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *sender) Dequeue(id uint32) (bool, error) {
+	return s.withQueued(id, func(msg model.Outgoing) error {
+		return s.outgoingDao.Remove(msg.Id)
+	})
+}
+
+func (s *sender) ReplaceQueued(id uint32, text string) (bool, error) {
+	return s.withQueued(id, func(msg model.Outgoing) error {
+		return s.outgoingDao.UpdateText(msg.Id, text)
+	})
+}
+
+// withQueued applies action to the queued message of the recipient while the queue of its route is locked
+func (s *sender) withQueued(id uint32, action func(msg model.Outgoing) error) (bool, error) {
+	msg, err := s.outgoingDao.GetByRecipientId(id)
+	if err != nil {
+		if err.Error() == "not found" {
+			return false, nil
+		}
+		return false, err
+	}
+
+	mu, ok := s.queueMu[msg.Route]
+	if !ok {
+		return false, errors.New("Unknown SMSC route " + msg.Route)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	//the message may have been claimed for submit while waiting for the lock
+	msg, err = s.outgoingDao.GetByRecipientId(id)
+	if err != nil {
+		if err.Error() == "not found" {
+			return false, nil
+		}
+		return false, err
+	}
+	if msg.InFlight {
+		return false, nil
+	}
+
+	err = action(msg)
+	if err != nil {
+		if err.Error() == "not found" {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *sender) Cancel(route, sender, phone, smscId string) error {
+	client := s.router.Client(route)
+	if client == nil {
+		return errors.New("Unknown SMSC route " + route)
+	}
+	return client.CancelMessage(sender, phone, smscId)
+}
+
+func (s *sender) Replace(route, sender, smscId, originalText, text string) error {
+	client := s.router.Client(route)
+	if client == nil {
+		return errors.New("Unknown SMSC route " + route)
+	}
+	return client.ReplaceMessage(sender, smscId, originalText, text)
+}
+
+func (s *sender) Query(route, sender, smscId string) (Receipt, error) {
+	client := s.router.Client(route)
+	if client == nil {
+		return Receipt{}, errors.New("Unknown SMSC route " + route)
+	}
+	return client.QueryMessage(sender, smscId)
+}
+
+func (s *sender) ReadPackets(client SmppClient) {
 	for {
-		if s.smppClient.IsConnected() {
-			err := s.smppClient.ReadPacket()
+		if client.IsConnected() {
+			err := client.ReadPacket()
 			if err != nil {
 				zap.L().Error("Error reading packets", zap.Error(err))
 			}
@@ -84,10 +299,10 @@ func (s *sender) ReadPackets() {
 	}
 }
 
-func (s *sender) CheckConnection() {
+func (s *sender) CheckConnection(client SmppClient) {
 	for {
-		if !s.smppClient.IsConnected() {
-			err := s.smppClient.Reconnect()
+		if !client.IsConnected() {
+			err := client.Reconnect()
 			if err != nil {
 				zap.L().Error("Error reconnecting", zap.Error(err))
 			}
@@ -96,30 +311,163 @@ func (s *sender) CheckConnection() {
 	}
 }
 
-func (s *sender) processOutgoing() {
+// activeRoute returns the route itself if it is available, otherwise its backup
+func (s *sender) activeRoute(route string) string {
+	if s.available(route) {
+		return route
+	}
+
+	backup := s.router.Backup(route)
+	if backup != "" && s.available(backup) {
+		return backup
+	}
+
+	return route
+}
+
+func (s *sender) available(route string) bool {
+	return s.router.Client(route).IsConnected() && !s.health[route].suspended()
+}
+
+func (s *sender) processOutgoing(route string) {
 	sleepDuration := time.Microsecond * 500
 	for {
-		if s.smppClient.IsConnected() {
+		//messages of the route are sent via backup while the route is unavailable
+		active := s.activeRoute(route)
+		client := s.router.Client(active)
+		if !client.IsConnected() {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		queued, err := s.sendFirst(route, active, client)
+		if !queued {
+			//no new messages, wait for a signal
 			select {
-			case val, ok := <-s.out:
-				if ok {
-					sms := val.(sms)
-					err := s.smppClient.SendMessage(sms.Id, sms.Sender, sms.Phone, sms.Text)
-					if err != nil {
-						zap.L().Error("Error sending message", zap.Error(err))
-					}
-					//sleep to avoid sending messages without pauses
-					time.Sleep(sleepDuration)
-				} else {
-					//channel closed, should not arrive here
-					return
-				}
-			default:
-				//no new messages, no-op
-				time.Sleep(time.Second)
+			case <-s.queued[route]:
+			case <-time.After(time.Second):
 			}
-		} else {
+			continue
+		}
+		if err != nil {
 			time.Sleep(time.Second)
+			continue
+		}
+
+		//sleep to avoid sending messages without pauses
+		time.Sleep(sleepDuration)
+	}
+}
+
+// sendFirst submits the oldest message of the route via the active route,
+// returns false if the queue is empty
+func (s *sender) sendFirst(route, active string, client SmppClient) (bool, error) {
+	msg, err := s.claimFirst(route)
+	if err != nil {
+		if err.Error() != "not found" {
+			zap.L().Error("Error reading outgoing queue", zap.Error(err))
 		}
+		return false, err
 	}
+
+	//messages are removed from the queue only after submit results of all parts are recorded,
+	//so after restart sending resumes from where it stopped
+	err = client.SendMessage(msg.RecipientId, msg.Sender, msg.Phone, msg.Text, msg.Options)
+	if err != nil {
+		zap.L().Error("Error sending message", zap.String("route", active), zap.Error(err))
+		s.handleSendFailure(client, active, msg.Id, msg.RecipientId)
+		return true, err
+	}
+
+	return true, nil
+}
+
+// claimFirst marks the oldest message of the route in flight, so that it is neither dequeued nor sent again
+// while it is submitted; the lock is not held during submit, which may wait for the window and the rate limit
+func (s *sender) claimFirst(route string) (model.Outgoing, error) {
+	s.queueMu[route].Lock()
+	defer s.queueMu[route].Unlock()
+
+	msg, err := s.outgoingDao.GetFirst(route)
+	if err != nil {
+		return msg, err
+	}
+	return msg, s.outgoingDao.SetInFlight(msg.Id, true)
+}
+
+// completePart counts the final submit result of a part and removes the message from the queue after the last one
+func (s *sender) completePart(result SubmitResult) {
+	s.doneMu.Lock()
+	defer s.doneMu.Unlock()
+
+	//message failed as a whole
+	partsCount := result.PartsCount
+	if result.PartNo == 0 {
+		partsCount = 0
+	}
+
+	_, err := s.outgoingDao.CompletePart(result.Id, partsCount)
+	if err != nil && err.Error() != "not found" {
+		zap.L().Error("Error updating outgoing message", zap.Uint32("id", result.Id), zap.Error(err))
+	}
+}
+
+func (s *sender) handleSendFailure(client SmppClient, route string, id, recipientId uint32) {
+	//nothing is submitted, the message is sent again
+	err := s.outgoingDao.SetInFlight(id, false)
+	if err != nil {
+		zap.L().Error("Error updating outgoing message", zap.Error(err))
+	}
+
+	//connection failures do not count, the message is resent after reconnect
+	if !client.IsConnected() {
+		return
+	}
+
+	attempts, err := s.outgoingDao.IncAttempts(id)
+	if err != nil {
+		zap.L().Error("Error updating outgoing message", zap.Error(err))
+		return
+	}
+	if attempts < maxSendAttempts {
+		return
+	}
+
+	zap.L().Warn("Dropping message after failed attempts", zap.Uint32("id", recipientId), zap.Int("attempts", attempts))
+	err = s.outgoingDao.Remove(id)
+	if err != nil {
+		zap.L().Error("Error removing message from outgoing queue", zap.Error(err))
+	}
+	if s.submitSmHandler != nil {
+		go s.submitSmHandler(SubmitResult{Id: recipientId, Status: uint32(smpp.ESME_RSUBMITFAIL), Route: route})
+	}
+}
+
+func (h *routeHealth) record(status uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if status == uint32(smpp.ESME_ROK) {
+		h.failures = 0
+		return
+	}
+
+	//messages rejected by SMSC, e.g. for invalid destination, do not count
+	if !isTransient(smpp.CMDStatus(status)) && !bindFailureStatuses[smpp.CMDStatus(status)] {
+		return
+	}
+
+	h.failures++
+	if h.failures >= failoverThreshold {
+		h.failures = 0
+		h.suspendedUntil = time.Now().Add(failoverCooldown)
+		zap.L().Warn("Too many submit failures, route is suspended", zap.Duration("cooldown", failoverCooldown))
+	}
+}
+
+func (h *routeHealth) suspended() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return time.Now().Before(h.suspendedUntil)
 }
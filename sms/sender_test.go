@@ -1,24 +1,34 @@
 package sms
 
 import (
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/cskr/pubsub"
+	smpp "github.com/Dilshat/smpp34"
+	"github.com/dilshat/sms-sender/model"
 	"github.com/stretchr/testify/require"
 )
 
 var (
 	submitHandlerBound  bool
 	deliverHandlerBound bool
+	inboundHandlerBound bool
 	connectCount        int
 	packetsCount        int
-	messageSent         bool
+	queuedCount         int
+	failedId            uint32
 )
 
 type mockSmppClient struct {
 	connnected bool
 	panic      bool
+	sendErr    error
+	//error of sender validation
+	senderErr error
+	//sent receives ids of sent messages
+	sent chan uint32
 }
 
 func (m mockSmppClient) Connect() error {
@@ -29,9 +39,27 @@ func (m mockSmppClient) IsConnected() bool {
 	return m.connnected
 }
 
-func (m mockSmppClient) SendMessage(id uint32, from, phone, text string) error {
-	messageSent = true
-	return nil
+func (m mockSmppClient) SendMessage(id uint32, from, phone, text string, options model.SubmitOptions) error {
+	if m.sent != nil {
+		m.sent <- id
+	}
+	return m.sendErr
+}
+
+func (m mockSmppClient) ValidateSender(sender string) error {
+	return m.senderErr
+}
+
+func (m mockSmppClient) CancelMessage(from, phone, smscId string) error {
+	return m.sendErr
+}
+
+func (m mockSmppClient) ReplaceMessage(from, smscId, originalText, text string) error {
+	return m.sendErr
+}
+
+func (m mockSmppClient) QueryMessage(from, smscId string) (Receipt, error) {
+	return Receipt{SmscId: smscId, Status: "DELIVRD"}, m.sendErr
 }
 
 func (m mockSmppClient) Disconnect() {
@@ -48,14 +76,18 @@ func (m mockSmppClient) Reconnect() error {
 	return nil
 }
 
-func (m mockSmppClient) BindSubmitSmResponseHandler(handler func(id, status uint32, smscId string)) {
+func (m mockSmppClient) BindSubmitSmResponseHandler(handler func(result SubmitResult)) {
 	submitHandlerBound = true
 }
 
-func (m mockSmppClient) BindDeliverSmHandler(handler func(smscId string, status string)) {
+func (m mockSmppClient) BindDeliverSmHandler(handler func(receipt Receipt)) {
 	deliverHandlerBound = true
 }
 
+func (m mockSmppClient) BindInboundHandler(handler func(msg InboundMessage)) {
+	inboundHandlerBound = true
+}
+
 func (m mockSmppClient) ReadPacket() error {
 	if m.panic {
 		packetsCount++
@@ -67,28 +99,249 @@ func (m mockSmppClient) ReadPacket() error {
 	return nil
 }
 
+func newTestRouter(client SmppClient) Router {
+	router, _ := NewRouter([]Route{{Name: ROUTE, Client: client}}, ROUTE)
+	return router
+}
+
 func TestSender_Start(t *testing.T) {
-	ps := pubsub.New(1)
-	sender := sender{ps: ps, out: ps.Sub(OUT), smppClient: &mockSmppClient{connnected: true}}
-	sender.Send(123, "sender", "phone", "text")
+	outgoingDao := &mockOutgoingDao{queue: []model.Outgoing{{Id: 1, RecipientId: 122, Route: ROUTE, InFlight: true}}}
+	sent := make(chan uint32, 2)
+	sender := NewSender(newTestRouter(&mockSmppClient{connnected: true, sent: sent}), outgoingDao)
+	sender.Send(123, "sender", "phone", "text", model.SubmitOptions{})
 
 	err := sender.Start()
-	time.Sleep(time.Second * 2)
 
 	require.NoError(t, err)
-	require.True(t, messageSent)
+	//message interrupted by restart is sent again
+	for _, id := range []uint32{122, 123} {
+		select {
+		case sentId := <-sent:
+			require.Equal(t, id, sentId)
+		case <-time.After(time.Second * 5):
+			t.Fatal("message is not sent")
+		}
+	}
+	//messages stay queued until their submit results are recorded
+	require.Equal(t, 0, outgoingDao.removed())
+}
+
+func TestSender_completePart(t *testing.T) {
+	outgoingDao := &mockOutgoingDao{queue: []model.Outgoing{{Id: 1, RecipientId: 123, Route: ROUTE}}}
+	sender := NewSender(newTestRouter(mockSmppClient{connnected: true}), outgoingDao).(*sender)
+
+	queued, err := sender.sendFirst(ROUTE, ROUTE, mockSmppClient{connnected: true})
+
+	require.NoError(t, err)
+	require.True(t, queued)
+	require.True(t, outgoingDao.queue[0].InFlight)
+
+	//claimed message is neither sent again nor dequeued
+	queued, _ = sender.sendFirst(ROUTE, ROUTE, mockSmppClient{connnected: true})
+
+	require.False(t, queued)
+
+	dequeued, err := sender.Dequeue(123)
+
+	require.NoError(t, err)
+	require.False(t, dequeued)
+
+	sender.completePart(SubmitResult{Id: 123, PartNo: 1, PartsCount: 2})
+
+	require.Equal(t, 0, outgoingDao.removed())
+
+	sender.completePart(SubmitResult{Id: 123, PartNo: 2, PartsCount: 2})
+
+	require.Equal(t, 1, outgoingDao.removed())
 }
 
 func TestSender_Send(t *testing.T) {
-	ps := pubsub.New(0)
-	sender := sender{ps: ps, out: ps.Sub(OUT), smppClient: mockSmppClient{connnected: true}}
+	queuedCount = 0
+	outgoingDao := &mockOutgoingDao{}
+	sender := NewSender(newTestRouter(mockSmppClient{connnected: true}), outgoingDao).(*sender)
+
+	err := sender.Send(123, "sender", "phone", "text", model.SubmitOptions{})
 
-	sender.Send(123, "sender", "phone", "text")
+	require.NoError(t, err)
+	require.Equal(t, 1, queuedCount)
+	require.Equal(t, ROUTE, outgoingDao.queue[0].Route)
+	require.Len(t, sender.queued[ROUTE], 1)
 
-	val, ok := <-sender.out
+	//queued while disconnected as well
+	sender.router = newTestRouter(mockSmppClient{})
 
-	require.True(t, ok)
-	require.IsType(t, sms{}, val)
+	err = sender.Send(123, "sender", "phone", "text", model.SubmitOptions{})
+
+	require.NoError(t, err)
+	require.Equal(t, 2, queuedCount)
+}
+
+func TestSender_handleSendFailure(t *testing.T) {
+	failedId = 0
+	outgoingDao := &mockOutgoingDao{queue: []model.Outgoing{{Id: 1, RecipientId: 123, InFlight: true}}}
+	sender := sender{outgoingDao: outgoingDao}
+	done := make(chan struct{})
+	sender.submitSmHandler = func(result SubmitResult) {
+		failedId = result.Id
+		close(done)
+	}
+
+	for i := 0; i < maxSendAttempts; i++ {
+		sender.handleSendFailure(mockSmppClient{connnected: true}, ROUTE, 1, 123)
+	}
+	<-done
+
+	require.Equal(t, 1, outgoingDao.removed())
+	require.Equal(t, uint32(123), failedId)
+}
+
+func TestSender_activeRoute(t *testing.T) {
+	router, _ := NewRouter([]Route{
+		{Name: ROUTE, Client: mockSmppClient{connnected: false}, Backup: ROUTE2},
+		{Name: ROUTE2, Client: mockSmppClient{connnected: true}},
+	}, ROUTE)
+	snd := NewSender(router, &mockOutgoingDao{}).(*sender)
+
+	//primary is down
+	require.Equal(t, ROUTE2, snd.activeRoute(ROUTE))
+	require.Equal(t, ROUTE2, snd.activeRoute(ROUTE2))
+
+	router, _ = NewRouter([]Route{
+		{Name: ROUTE, Client: mockSmppClient{connnected: true}, Backup: ROUTE2},
+		{Name: ROUTE2, Client: mockSmppClient{connnected: true}},
+	}, ROUTE)
+	snd = NewSender(router, &mockOutgoingDao{}).(*sender)
+
+	require.Equal(t, ROUTE, snd.activeRoute(ROUTE))
+
+	//primary fails to submit
+	for i := 0; i < failoverThreshold; i++ {
+		snd.health[ROUTE].record(uint32(smpp.ESME_RSYSERR))
+	}
+
+	require.Equal(t, ROUTE2, snd.activeRoute(ROUTE))
+
+	//primary recovers after cooldown
+	snd.health[ROUTE].suspendedUntil = time.Now()
+
+	require.Equal(t, ROUTE, snd.activeRoute(ROUTE))
+}
+
+func TestRouteHealth_record(t *testing.T) {
+	health := &routeHealth{}
+
+	for i := 0; i < failoverThreshold-1; i++ {
+		health.record(uint32(smpp.ESME_RSYSERR))
+	}
+	health.record(uint32(smpp.ESME_ROK))
+	health.record(uint32(smpp.ESME_RSYSERR))
+
+	require.False(t, health.suspended())
+
+	//permanent rejections of messages do not suspend the route
+	for i := 0; i < failoverThreshold; i++ {
+		health.record(uint32(smpp.ESME_RINVDSTADR))
+	}
+
+	require.False(t, health.suspended())
+
+	for i := 0; i < failoverThreshold; i++ {
+		health.record(uint32(smpp.ESME_RSUBMITFAIL))
+	}
+
+	require.True(t, health.suspended())
+}
+
+func TestSender_ValidateSender(t *testing.T) {
+	router, _ := NewRouter([]Route{
+		{Name: ROUTE, Client: mockSmppClient{}, Backup: "backup"},
+		{Name: "backup", Client: mockSmppClient{senderErr: errors.New("Alphanumeric sender is too long")}},
+	}, ROUTE)
+	sender := NewSender(router, &mockOutgoingDao{})
+
+	//the message may be sent via the backup route as well
+	err := sender.ValidateSender(ROUTE, "Awesome")
+
+	require.Error(t, err)
+
+	sender = NewSender(newTestRouter(mockSmppClient{}), &mockOutgoingDao{})
+
+	err = sender.ValidateSender(ROUTE, "Awesome")
+
+	require.NoError(t, err)
+}
+
+func TestSender_Queued(t *testing.T) {
+	outgoingDao := &mockOutgoingDao{queue: []model.Outgoing{{Id: 1, RecipientId: 123, Route: ROUTE, InFlight: true}}}
+	sender := NewSender(newTestRouter(mockSmppClient{}), outgoingDao)
+
+	queued, err := sender.Queued(123)
+
+	require.NoError(t, err)
+	require.True(t, queued)
+
+	queued, err = sender.Queued(124)
+
+	require.NoError(t, err)
+	require.False(t, queued)
+}
+
+func TestSender_Dequeue(t *testing.T) {
+	outgoingDao := &mockOutgoingDao{queue: []model.Outgoing{{Id: 1, RecipientId: 123, Route: ROUTE}}}
+	sender := NewSender(newTestRouter(mockSmppClient{}), outgoingDao)
+
+	dequeued, err := sender.Dequeue(123)
+
+	require.NoError(t, err)
+	require.True(t, dequeued)
+	require.Equal(t, 1, outgoingDao.removed())
+
+	//already submitted
+	dequeued, err = sender.Dequeue(123)
+
+	require.NoError(t, err)
+	require.False(t, dequeued)
+}
+
+func TestSender_ReplaceQueued(t *testing.T) {
+	outgoingDao := &mockOutgoingDao{queue: []model.Outgoing{{Id: 1, RecipientId: 123, Route: ROUTE, Text: "text"}}}
+	sender := NewSender(newTestRouter(mockSmppClient{}), outgoingDao)
+
+	replaced, err := sender.ReplaceQueued(123, "new text")
+
+	require.NoError(t, err)
+	require.True(t, replaced)
+	require.Equal(t, "new text", outgoingDao.queue[0].Text)
+
+	replaced, err = sender.ReplaceQueued(124, "new text")
+
+	require.NoError(t, err)
+	require.False(t, replaced)
+}
+
+func TestSender_Cancel(t *testing.T) {
+	sender := NewSender(newTestRouter(mockSmppClient{sendErr: smpp.ESME_RCANCELFAIL}), &mockOutgoingDao{})
+
+	err := sender.Cancel(ROUTE, "sender", "phone", "1203837180")
+
+	require.Equal(t, smpp.ESME_RCANCELFAIL, err)
+
+	err = sender.Cancel(ROUTE2, "sender", "phone", "1203837180")
+
+	require.Error(t, err)
+}
+
+func TestSender_Query(t *testing.T) {
+	sender := NewSender(newTestRouter(mockSmppClient{}), &mockOutgoingDao{})
+
+	receipt, err := sender.Query(ROUTE, "sender", "1203837180")
+
+	require.NoError(t, err)
+	require.Equal(t, "DELIVRD", receipt.Status)
+
+	_, err = sender.Query(ROUTE2, "sender", "1203837180")
+
+	require.Error(t, err)
 }
 
 func TestSender_ReadPackets(t *testing.T) {
@@ -97,9 +350,9 @@ func TestSender_ReadPackets(t *testing.T) {
 		require.Equal(t, 2, packetsCount)
 	}()
 
-	sender := sender{smppClient: mockSmppClient{connnected: true, panic: true}}
+	sender := sender{}
 
-	sender.ReadPackets()
+	sender.ReadPackets(mockSmppClient{connnected: true, panic: true})
 }
 
 func TestSender_CheckConnection(t *testing.T) {
@@ -108,26 +361,155 @@ func TestSender_CheckConnection(t *testing.T) {
 		require.Equal(t, 2, connectCount)
 	}()
 
-	sender := sender{smppClient: mockSmppClient{panic: true}}
+	sender := sender{}
 
-	sender.CheckConnection()
+	sender.CheckConnection(mockSmppClient{panic: true})
 }
 
 func TestSender_BindDeliverSmHandler(t *testing.T) {
-	sender := NewSender(mockSmppClient{})
+	sender := NewSender(newTestRouter(mockSmppClient{}), &mockOutgoingDao{})
 
-	sender.BindDeliverSmHandler(func(smscId string, status string) {
+	sender.BindDeliverSmHandler(func(receipt Receipt) {
 	})
 
 	require.True(t, deliverHandlerBound)
 }
 
 func TestSender_BindSubmitSmResponseHandler(t *testing.T) {
-	sender := NewSender(mockSmppClient{})
+	sender := NewSender(newTestRouter(mockSmppClient{}), &mockOutgoingDao{})
 
-	sender.BindSubmitSmResponseHandler(func(id, status uint32, smscId string) {
+	sender.BindSubmitSmResponseHandler(func(result SubmitResult) {
 
 	})
 
 	require.True(t, submitHandlerBound)
 }
+
+func TestSender_BindInboundHandler(t *testing.T) {
+	sender := NewSender(newTestRouter(mockSmppClient{}), &mockOutgoingDao{})
+
+	sender.BindInboundHandler(func(msg InboundMessage) {
+	})
+
+	require.True(t, inboundHandlerBound)
+}
+
+type mockOutgoingDao struct {
+	//guards the queue used by processOutgoing of the sender
+	mu           sync.Mutex
+	queue        []model.Outgoing
+	removedCount int
+}
+
+func (m *mockOutgoingDao) removed() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.removedCount
+}
+
+func (m *mockOutgoingDao) Push(recipientId uint32, route, sender, phone, text string, options model.SubmitOptions) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	queuedCount++
+	id := uint32(len(m.queue) + 1)
+	m.queue = append(m.queue, model.Outgoing{Id: id, RecipientId: recipientId, Route: route, Sender: sender, Phone: phone, Text: text, Options: options})
+	return id, nil
+}
+
+func (m *mockOutgoingDao) GetFirst(route string) (model.Outgoing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, outgoing := range m.queue {
+		if outgoing.Route == route && !outgoing.InFlight {
+			return outgoing, nil
+		}
+	}
+	return model.Outgoing{}, errors.New("not found")
+}
+
+func (m *mockOutgoingDao) IncAttempts(id uint32) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.queue {
+		if m.queue[i].Id == id {
+			m.queue[i].Attempts++
+			return m.queue[i].Attempts, nil
+		}
+	}
+	return 0, errors.New("not found")
+}
+
+func (m *mockOutgoingDao) Remove(id uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.queue {
+		if m.queue[i].Id == id {
+			m.removedCount++
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func (m *mockOutgoingDao) GetByRecipientId(recipientId uint32) (model.Outgoing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, outgoing := range m.queue {
+		if outgoing.RecipientId == recipientId {
+			return outgoing, nil
+		}
+	}
+	return model.Outgoing{}, errors.New("not found")
+}
+
+func (m *mockOutgoingDao) UpdateText(id uint32, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.queue {
+		if m.queue[i].Id == id {
+			m.queue[i].Text = text
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func (m *mockOutgoingDao) SetInFlight(id uint32, inFlight bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.queue {
+		if m.queue[i].Id == id {
+			m.queue[i].InFlight = inFlight
+			m.queue[i].Done = 0
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func (m *mockOutgoingDao) CompletePart(recipientId uint32, partsCount int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.queue {
+		if m.queue[i].RecipientId == recipientId && m.queue[i].InFlight {
+			m.queue[i].Done++
+			if m.queue[i].Done < partsCount {
+				return false, nil
+			}
+			m.removedCount++
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, errors.New("not found")
+}
+
+func (m *mockOutgoingDao) RequeueInFlight() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.queue {
+		m.queue[i].InFlight = false
+	}
+	return nil
+}
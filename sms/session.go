@@ -0,0 +1,258 @@
+package sms
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	smpp "github.com/Dilshat/smpp34"
+)
+
+const (
+	dialTimeout = time.Second * 15
+	//time to wait for bind response
+	bindTimeout = time.Second * 5
+	//min enquire link interval in seconds
+	minEnquireLinkInterval = 10
+)
+
+// session is an SMPP transceiver, transmitter or receiver session over a TCP connection.
+// Unlike smpp.Transceiver it passes generic_nack to the reader
+// and reads PDUs split across several TCP segments
+type session struct {
+	conn    net.Conn
+	builder smpp.Smpp
+	seq     uint32
+	writeMu sync.Mutex
+	//1 while enquire_link_resp is awaited
+	enquiring int32
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// dialSession connects to SMSC, binds with bindId and starts sending enquire_link every eli seconds
+func dialSession(host string, port int, eli int, bindId smpp.CMDId, bindParams smpp.Params) (*session, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSession(conn)
+	err = s.bind(bindId, bindParams)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	if eli < minEnquireLinkInterval {
+		eli = minEnquireLinkInterval
+	}
+	go s.enquireLink(time.Duration(eli) * time.Second)
+
+	return s, nil
+}
+
+func newSession(conn net.Conn) *session {
+	return &session{conn: conn, closed: make(chan struct{})}
+}
+
+func (s *session) bind(bindId smpp.CMDId, bindParams smpp.Params) error {
+	params := smpp.Params{}
+	for field, value := range bindParams {
+		if field != smpp.SYSTEM_ID && field != smpp.PASSWORD {
+			params[field] = value
+		}
+	}
+	systemId, _ := bindParams[smpp.SYSTEM_ID].(string)
+	password, _ := bindParams[smpp.PASSWORD].(string)
+
+	pdu, err := s.builder.Bind(bindId, systemId, password, &params)
+	if err != nil {
+		return err
+	}
+	pdu.SetSeqNum(s.NextSeq())
+	err = s.write(pdu)
+	if err != nil {
+		return err
+	}
+
+	_ = s.conn.SetReadDeadline(time.Now().Add(bindTimeout))
+	resp, _, err := ReadPdu(s.conn)
+	_ = s.conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+
+	//response command id is the request one with the high bit set
+	if resp.GetHeader().Id != bindId|0x80000000 {
+		return smpp.SmppBindRespErr
+	}
+	if !resp.Ok() {
+		return smpp.SmppBindAuthErr("Bind auth failed. " + resp.GetHeader().Status.Error())
+	}
+
+	return nil
+}
+
+// enquireLink sends enquire_link every interval and closes the session
+// if the previous one is left without response
+func (s *session) enquireLink(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			if !atomic.CompareAndSwapInt32(&s.enquiring, 0, 1) {
+				s.Close()
+				return
+			}
+			pdu, _ := s.builder.EnquireLink()
+			pdu.SetSeqNum(s.NextSeq())
+			if s.write(pdu) != nil {
+				s.Close()
+				return
+			}
+		}
+	}
+}
+
+// NextSeq allocates sequence numbers of all PDUs sent over the connection, including enquire_link
+func (s *session) NextSeq() uint32 {
+	return (atomic.AddUint32(&s.seq, 1)-1)%maxSeq + 1
+}
+
+// Read blocks until submit_sm_resp, response to cancel_sm, replace_sm or query_sm, deliver_sm or generic_nack is received,
+// other PDUs are handled by the session itself
+func (s *session) Read() (smpp.Pdu, error) {
+	for {
+		pdu, header, err := ReadPdu(s.conn)
+		if err != nil {
+			if header == nil {
+				return nil, err
+			}
+			//PDU is read but not supported
+			_ = s.writeGenericNack(header.Sequence, smpp.ESME_RINVCMDID)
+			return nil, smpp.SmppPduErr
+		}
+
+		switch header.Id {
+		case smpp.SUBMIT_SM_RESP, smpp.CANCEL_SM_RESP, smpp.REPLACE_SM_RESP, smpp.QUERY_SM_RESP, smpp.DELIVER_SM, smpp.GENERIC_NACK:
+			return pdu, nil
+		case smpp.ENQUIRE_LINK:
+			resp, _ := s.builder.EnquireLinkResp(header.Sequence)
+			err = s.write(resp)
+			if err != nil {
+				return nil, err
+			}
+		case smpp.ENQUIRE_LINK_RESP:
+			atomic.StoreInt32(&s.enquiring, 0)
+		case smpp.UNBIND:
+			resp, _ := s.builder.UnbindResp(header.Sequence)
+			_ = s.write(resp)
+			s.Close()
+			return nil, io.EOF
+		default:
+			//responses to requests not sent by the client
+		}
+	}
+}
+
+func (s *session) SubmitSmEncoded(seq uint32, sourceAddr, destinationAddr string, shortMessage []byte, params *smpp.Params, tlvs map[uint16][]byte) error {
+	pdu, err := s.builder.SubmitSmEncoded(sourceAddr, destinationAddr, shortMessage, params)
+	if err != nil {
+		return err
+	}
+	for tag, value := range tlvs {
+		err = pdu.SetTLVField(int(tag), len(value), value)
+		if err != nil {
+			return err
+		}
+	}
+	pdu.SetSeqNum(seq)
+	return s.write(pdu)
+}
+
+func (s *session) CancelSm(seq uint32, smscId string, source address, destinationAddr string) error {
+	return s.write(newCancelSm(seq, smscId, source, destinationAddr))
+}
+
+func (s *session) ReplaceSm(seq uint32, smscId string, source address, shortMessage []byte) error {
+	return s.write(newReplaceSm(seq, smscId, source, shortMessage))
+}
+
+func (s *session) QuerySm(seq uint32, smscId string, source address) error {
+	return s.write(newQuerySm(seq, smscId, source))
+}
+
+func (s *session) DeliverSmResp(seq uint32, status smpp.CMDStatus) error {
+	pdu, _ := s.builder.DeliverSmResp(seq, status)
+	return s.write(pdu)
+}
+
+func (s *session) Unbind() error {
+	pdu, _ := s.builder.Unbind()
+	pdu.SetSeqNum(s.NextSeq())
+	return s.write(pdu)
+}
+
+func (s *session) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		_ = s.conn.Close()
+	})
+}
+
+func (s *session) writeGenericNack(seq uint32, status smpp.CMDStatus) error {
+	pdu, _ := s.builder.GenericNack(seq, status)
+	return s.write(pdu)
+}
+
+func (s *session) write(pdu smpp.Pdu) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_, err := s.conn.Write(pdu.Writer())
+	return err
+}
+
+// ReadPdu reads a whole PDU from the connection; header is returned
+// along with the error if the PDU was read but could not be parsed, the SMSC simulator reads PDUs with it as well
+func ReadPdu(conn net.Conn) (smpp.Pdu, *smpp.Header, error) {
+	l := make([]byte, 4)
+	if _, err := io.ReadFull(conn, l); err != nil {
+		return nil, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(l)
+	if length < 16 || length > smpp.MAX_PDU_SIZE {
+		return nil, nil, smpp.SmppPduSizeErr
+	}
+
+	data := make([]byte, length)
+	copy(data, l)
+	if _, err := io.ReadFull(conn, data[4:]); err != nil {
+		return nil, nil, err
+	}
+
+	header := smpp.ParsePduHeader(data[:16])
+	switch header.Id {
+	case smpp.CANCEL_SM_RESP, smpp.REPLACE_SM_RESP, smpp.QUERY_SM_RESP:
+		//not supported by smpp34, query_sm_resp is misparsed
+		return &rawPdu{Header: header, body: data[16:]}, header, nil
+	}
+
+	pdu, err := smpp.ParsePdu(data)
+	if err != nil {
+		return nil, header, err
+	}
+
+	return pdu, pdu.GetHeader(), nil
+}
@@ -0,0 +1,87 @@
+package sms
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Dilshat/smpp34"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession_NextSeq(t *testing.T) {
+	s := session{}
+
+	require.Equal(t, uint32(1), s.NextSeq())
+
+	//sequence numbers wrap around within the valid range
+	s.seq = maxSeq - 1
+	require.Equal(t, maxSeq, s.NextSeq())
+	require.Equal(t, uint32(1), s.NextSeq())
+}
+
+func TestSession_bind(t *testing.T) {
+	client, smsc := net.Pipe()
+	defer smsc.Close()
+	s := newSession(client)
+	defer s.Close()
+
+	go func() {
+		pdu, _, _ := ReadPdu(smsc)
+		resp, _ := (&smpp34.Smpp{}).BindResp(smpp34.BIND_TRANSCEIVER_RESP, pdu.GetHeader().Sequence, smpp34.ESME_RBINDFAIL, "smsc")
+		_, _ = smsc.Write(resp.Writer())
+	}()
+
+	err := s.bind(smpp34.BIND_TRANSCEIVER, smpp34.Params{smpp34.SYSTEM_ID: "id", smpp34.PASSWORD: "pwd"})
+
+	require.Error(t, err)
+}
+
+func TestSession_bindReceiver(t *testing.T) {
+	client, smsc := net.Pipe()
+	defer smsc.Close()
+	s := newSession(client)
+	defer s.Close()
+
+	bound := make(chan smpp34.Pdu, 1)
+	go func() {
+		pdu, _, _ := ReadPdu(smsc)
+		bound <- pdu
+		resp, _ := (&smpp34.Smpp{}).BindResp(smpp34.BIND_RECEIVER_RESP, pdu.GetHeader().Sequence, smpp34.ESME_ROK, "smsc")
+		_, _ = smsc.Write(resp.Writer())
+	}()
+
+	err := s.bind(smpp34.BIND_RECEIVER, smpp34.Params{smpp34.SYSTEM_ID: "id", smpp34.PASSWORD: "pwd", smpp34.SYSTEM_TYPE: "VMA", smpp34.ADDRESS_RANGE: "1414"})
+
+	require.NoError(t, err)
+	pdu := <-bound
+	require.Equal(t, smpp34.BIND_RECEIVER, pdu.GetHeader().Id)
+	require.Equal(t, "VMA", pdu.GetField(smpp34.SYSTEM_TYPE).String())
+	require.Equal(t, "1414", pdu.GetField(smpp34.ADDRESS_RANGE).String())
+}
+
+func TestSession_Read(t *testing.T) {
+	client, smsc := net.Pipe()
+	defer smsc.Close()
+	s := newSession(client)
+	defer s.Close()
+
+	go func() {
+		//enquire_link is answered by the session itself
+		enquireLink, _ := (&smpp34.Smpp{}).EnquireLink()
+		_, _ = smsc.Write(enquireLink.Writer())
+		resp, _, _ := ReadPdu(smsc)
+		if resp.GetHeader().Id != smpp34.ENQUIRE_LINK_RESP {
+			return
+		}
+
+		nack, _ := (&smpp34.Smpp{}).GenericNack(SEQ, smpp34.ESME_RTHROTTLED)
+		_, _ = smsc.Write(nack.Writer())
+	}()
+
+	pdu, err := s.Read()
+
+	require.NoError(t, err)
+	require.Equal(t, smpp34.GENERIC_NACK, pdu.GetHeader().Id)
+	require.Equal(t, SEQ, pdu.GetHeader().Sequence)
+	require.Equal(t, smpp34.ESME_RTHROTTLED, pdu.GetHeader().Status)
+}
@@ -1,80 +1,109 @@
 package sms
 
 import (
+	"bytes"
 	"context"
-	"crypto/rand"
-	"math"
-	"regexp"
+	"encoding/hex"
+	"errors"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	smpp "github.com/Dilshat/smpp34"
 	"github.com/Dilshat/smpp34/gsmutil"
-	"github.com/dilshat/sms-sender/util"
+	"github.com/dilshat/sms-sender/model"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
+const (
+	//max sequence number, valid range is 0x00000001 - 0x7FFFFFFF
+	maxSeq uint32 = 0x7FFFFFFF
+	//number of submits of a part failing with transient statuses before it is reported as failed
+	maxSubmitAttempts = 3
+	//delay before the first resubmit, doubled with every attempt
+	retryBackoff = time.Second
+	//time after throttling during which the send rate is not raised
+	throttleCooldown = time.Second * 10
+	//time to wait for response to cancel_sm, replace_sm and query_sm
+	operationTimeout = time.Second * 10
+	//time to wait for submit_sm_resp unless configured
+	defaultSubmitTimeout = time.Second * 60
+	//submits per second unless configured
+	defaultTps = 100
+	//interval of checks of watch
+	watchInterval = time.Second
+
+	//type of number and numbering plan indicator of destination addresses
+	destAddrTon = 1
+	destAddrNpi = 1
+
+	//data_coding bits of message class 0 (flash) and protocol_id of type 0 (silent) short message
+	dataCodingClass0 = 0x10
+	protocolIdType0  = 0x40
+)
+
 var (
-	dlvRctRx = *regexp.MustCompile(`(?s)id:(.+?) .* stat:([A-Z]+)`)
+	//statuses after which submit may succeed if repeated
+	transientStatuses = map[smpp.CMDStatus]bool{
+		smpp.ESME_RSYSERR:    true,
+		smpp.ESME_RMSGQFUL:   true,
+		smpp.ESME_RTHROTTLED: true,
+		smpp.ESME_RX_T_APPN:  true,
+	}
 )
 
 type RateLimiter interface {
 	// Wait blocks until the limiter permits an event to happen.
 	Wait(ctx context.Context) error
+	// Limit returns the maximum overall event rate.
+	Limit() rate.Limit
+	// SetLimit sets a new Limit for the limiter.
+	SetLimit(newLimit rate.Limit)
 }
 
 type TransceiverWrapper interface {
 	Unbind() error
 	Close()
-	SetNextId(id uint32)
+	//NextSeq allocates sequence number of a PDU
+	NextSeq() uint32
 	Read() (smpp.Pdu, error)
-	SubmitSmEncoded(sourceAddr, destinationAddr string, shortMessage []byte, params *smpp.Params) (seq uint32, err error)
+	SubmitSmEncoded(seq uint32, sourceAddr, destinationAddr string, shortMessage []byte, params *smpp.Params, tlvs map[uint16][]byte) error
+	CancelSm(seq uint32, smscId string, source address, destinationAddr string) error
+	ReplaceSm(seq uint32, smscId string, source address, shortMessage []byte) error
+	QuerySm(seq uint32, smscId string, source address) error
 	DeliverSmResp(seq uint32, status smpp.CMDStatus) error
 }
 
 type TransceiverWrapperFactory interface {
-	GetTransceiver(host string, port int, eli int, bindParams smpp.Params) (TransceiverWrapper, error)
+	//GetTransceiver opens a session bound with bindId, which is BIND_TRANSCEIVER, BIND_TRANSMITTER or BIND_RECEIVER
+	GetTransceiver(host string, port int, eli int, bindId smpp.CMDId, bindParams smpp.Params) (TransceiverWrapper, error)
 }
 
 type transceiverWrapperFactory struct {
 }
 
-type transceiverWrapper struct {
-	tr *smpp.Transceiver
-}
-
-func (t *transceiverWrapper) Unbind() error {
-	return t.tr.Unbind()
-}
-
-func (t *transceiverWrapper) Close() {
-	t.tr.Close()
-}
-
-func (t *transceiverWrapper) SetNextId(id uint32) {
-	t.tr.NewSeqNumFunc = func() uint32 {
-		return id
-	}
-}
-
-func (t *transceiverWrapper) Read() (smpp.Pdu, error) {
-	return t.tr.Read()
-}
-
-func (t *transceiverWrapper) SubmitSmEncoded(sourceAddr, destinationAddr string, shortMessage []byte, params *smpp.Params) (seq uint32, err error) {
-	return t.tr.SubmitSmEncoded(sourceAddr, destinationAddr, shortMessage, params)
-}
-
-func (t *transceiverWrapper) DeliverSmResp(seq uint32, status smpp.CMDStatus) error {
-	return t.tr.DeliverSmResp(seq, status)
-}
-
-func (t *transceiverWrapperFactory) GetTransceiver(host string, port int, eli int, bindParams smpp.Params) (TransceiverWrapper, error) {
-	tr, err := smpp.NewTransceiver(host, port, eli, bindParams)
+func (t *transceiverWrapperFactory) GetTransceiver(host string, port int, eli int, bindId smpp.CMDId, bindParams smpp.Params) (TransceiverWrapper, error) {
+	s, err := dialSession(host, port, eli, bindId, bindParams)
 	if err != nil {
 		return nil, err
 	}
-	return &transceiverWrapper{tr: tr}, nil
+	return s, nil
+}
+
+// SubmitResult is the outcome of submit_sm of a single part of a message
+type SubmitResult struct {
+	//Id of the recipient
+	Id uint32
+	//PartNo is the 1-based number of the part, 0 if the whole message failed before submit
+	PartNo     int
+	PartsCount int
+	Status     uint32
+	SmscId     string
+	//Route is the name of SMSC connection used, it is set by Sender
+	Route string
+	//Retry is set if the part failed with a transient status and is resubmitted, its final result is reported later
+	Retry bool
 }
 
 type SmppClient interface {
@@ -82,9 +111,20 @@ type SmppClient interface {
 	Disconnect()
 	Reconnect() error
 	IsConnected() bool
-	SendMessage(id uint32, from, phone, text string) error
-	BindSubmitSmResponseHandler(handler func(id, status uint32, smscId string))
-	BindDeliverSmHandler(handler func(smscId string, status string))
+	SendMessage(id uint32, from, phone, text string, options model.SubmitOptions) error
+	//ValidateSender checks if the sender can be sent as source address with TON/NPI configured for SMSC
+	ValidateSender(sender string) error
+	//CancelMessage cancels the part submitted with smscId, blocks until SMSC responds
+	CancelMessage(from, phone, smscId string) error
+	//ReplaceMessage replaces text of the single part message submitted with smscId,
+	//the new text must fit one part and use the encoding of the original one
+	ReplaceMessage(from, smscId, originalText, text string) error
+	//QueryMessage returns state of the message submitted with smscId as a receipt, blocks until SMSC responds
+	QueryMessage(from, smscId string) (Receipt, error)
+	BindSubmitSmResponseHandler(handler func(result SubmitResult))
+	BindDeliverSmHandler(handler func(receipt Receipt))
+	//BindInboundHandler binds handler of mobile originated messages
+	BindInboundHandler(handler func(msg InboundMessage))
 	ReadPacket() error
 }
 
@@ -95,34 +135,151 @@ type smppClient struct {
 	smscPassword     string
 	smscEnqLnkIntrvl int
 	smsMaxLen        int
+	//time after which a submit without response is considered failed
+	submitTimeout time.Duration
+	//configured send rate, restored after throttling
+	tps int
 
 	connected int32
+	//serializes submits of concurrent senders
+	sendMu sync.Mutex
+	//parts awaiting submit_sm_resp by sequence number
+	inflightMu sync.Mutex
+	inflight   map[uint32]inflightSubmit
+	//slots of outstanding submits, nil means unlimited
+	window chan struct{}
+	//cancel_sm, replace_sm and query_sm awaiting response by sequence number
+	operationsMu sync.Mutex
+	operations   map[uint32]chan smpp.Pdu
+	//time of the last throttling or rate increase after it
+	throttleMu  sync.Mutex
+	throttledAt time.Time
 
 	transceiver        TransceiverWrapper //*smpp.Transceiver
 	transceiverFactory TransceiverWrapperFactory
 	rateLimiter        RateLimiter
-	submitSmHandler    func(id, status uint32, smscId string)
-	deliverHandler     func(smscId string, status string)
+	submitSmHandler    func(result SubmitResult)
+	deliverHandler     func(receipt Receipt)
+	inboundHandler     func(msg InboundMessage)
+	//bind parameters, receiver bind of BIND_MODE_TXRX, transceiver is the transmitter bind then
+	bind       BindConfig
+	receiverMu sync.Mutex
+	receiver   TransceiverWrapper
+	//TON/NPI of source address configured for SMSC, negative values are detected from the sender
+	sourceTon int
+	sourceNpi int
+	//mode of linking parts of long messages and last concatenation reference per destination
+	concatMode string
+	refsMu     sync.Mutex
+	refs       map[string]uint16
+	//parts of concatenated inbound messages
+	inbound reassembler
+	//closed to stop watch of the current connection, nil while disconnected
+	watchMu   sync.Mutex
+	watchStop chan struct{}
+}
+
+// inflightSubmit is a submitted part awaiting response, it keeps everything needed to resubmit it
+type inflightSubmit struct {
+	segment  SubmitResult
+	from     string
+	phone    string
+	part     []byte
+	params   smpp.Params
+	tlvs     map[uint16][]byte
+	attempts int
+	sentAt   time.Time
 }
 
-func (c *smppClient) BindSubmitSmResponseHandler(handler func(id, status uint32, smscId string)) {
+func (c *smppClient) BindSubmitSmResponseHandler(handler func(result SubmitResult)) {
 	c.submitSmHandler = handler
 }
 
-func (c *smppClient) BindDeliverSmHandler(handler func(smscId string, status string)) {
+func (c *smppClient) BindDeliverSmHandler(handler func(receipt Receipt)) {
 	c.deliverHandler = handler
 }
 
-func NewClient(smscIp string, smscPort int, smscAccount, smscPassword string, smscEnqLnkIntrvl, tps int) SmppClient {
-	return &smppClient{
-		smscIp:             smscIp,
-		smscPort:           smscPort,
-		smscAccount:        smscAccount,
-		smscPassword:       smscPassword,
-		smscEnqLnkIntrvl:   smscEnqLnkIntrvl,
+func (c *smppClient) BindInboundHandler(handler func(msg InboundMessage)) {
+	c.inboundHandler = handler
+}
+
+// ClientConfig holds settings of SMSC connection
+type ClientConfig struct {
+	Host     string
+	Port     int
+	SystemId string
+	Password string
+	//EnquireLinkSec is the interval of enquire_link in seconds
+	EnquireLinkSec int
+	//Tps limits submits per second, 100 unless positive
+	Tps int
+	//Window limits the number of submits awaiting response, 0 means unlimited
+	Window int
+	//SubmitTimeoutSec is the time after which submits without response are reported as failed, 60 unless positive
+	SubmitTimeoutSec int
+	//ConcatMode is CONCAT_UDH8, CONCAT_UDH16, CONCAT_SAR or CONCAT_PAYLOAD
+	ConcatMode string
+	//SourceTon and SourceNpi override TON/NPI of source address, nil or negative values are detected from the sender of every message
+	SourceTon *int
+	SourceNpi *int
+	Bind      BindConfig
+}
+
+// NewClient creates SMPP client of the SMSC connection
+func NewClient(config ClientConfig) SmppClient {
+	concatMode := config.ConcatMode
+	switch concatMode {
+	case CONCAT_UDH8, CONCAT_UDH16, CONCAT_SAR, CONCAT_PAYLOAD:
+	default:
+		zap.L().Warn("Unknown concatenation mode, using "+CONCAT_UDH8, zap.String("mode", concatMode))
+		concatMode = CONCAT_UDH8
+	}
+	bind := config.Bind
+	switch bind.Mode {
+	case "", BIND_MODE_TRX, BIND_MODE_TXRX:
+	default:
+		zap.L().Warn("Unknown bind mode, using "+BIND_MODE_TRX, zap.String("mode", bind.Mode))
+		bind.Mode = BIND_MODE_TRX
+	}
+
+	submitTimeout := time.Duration(config.SubmitTimeoutSec) * time.Second
+	if submitTimeout <= 0 {
+		submitTimeout = defaultSubmitTimeout
+	}
+	tps := config.Tps
+	if tps <= 0 {
+		tps = defaultTps
+	}
+
+	client := &smppClient{
+		smscIp:             config.Host,
+		smscPort:           config.Port,
+		smscAccount:        config.SystemId,
+		smscPassword:       config.Password,
+		smscEnqLnkIntrvl:   config.EnquireLinkSec,
+		submitTimeout:      submitTimeout,
+		tps:                tps,
 		rateLimiter:        rate.NewLimiter(rate.Limit(tps), 1),
 		transceiverFactory: &transceiverWrapperFactory{},
+		inflight:           make(map[uint32]inflightSubmit),
+		concatMode:         concatMode,
+		sourceTon:          optionalCode(config.SourceTon),
+		sourceNpi:          optionalCode(config.SourceNpi),
+		bind:               bind,
+	}
+	if config.Window > 0 {
+		client.window = make(chan struct{}, config.Window)
 	}
+
+	return client
+}
+
+// optionalCode returns the configured TON/NPI, -1 if it is to be detected
+func optionalCode(code *int) int {
+	if code == nil || *code < 0 {
+		return -1
+	}
+	return *code
 }
 
 func (c *smppClient) Disconnect() {
@@ -132,14 +289,23 @@ func (c *smppClient) Disconnect() {
 			zap.L().Error("Recovered in Disconnect")
 		}
 		atomic.StoreInt32(&c.connected, 0)
+
+		//sequence numbers restart with the next session, so responses to these parts never arrive
+		for _, segment := range c.removeInflight(func(inflightSubmit) bool { return true }) {
+			zap.L().Warn("Submit left without response on disconnect", zap.Uint32("id", segment.Id), zap.Int("part", segment.PartNo))
+			c.reportFailed(segment)
+		}
 	}()
 
 	zap.L().Info("Disconnecting from SMSC")
 
+	c.stopWatch()
+
 	if c.transceiver != nil {
 		_ = c.transceiver.Unbind()
 		c.transceiver.Close()
 	}
+	c.closeReceiver()
 }
 
 func (c *smppClient) Connect() error {
@@ -154,18 +320,15 @@ func (c *smppClient) Connect() error {
 	zap.L().Info("Connecting to SMSC")
 
 	var err error
-	c.transceiver, err = c.transceiverFactory.GetTransceiver(
-		c.smscIp,
-		c.smscPort,
-		c.smscEnqLnkIntrvl,
-		smpp.Params{
-			"system_id": c.smscAccount,
-			"password":  c.smscPassword,
-		},
-	)
+	if c.bind.Mode == BIND_MODE_TXRX {
+		err = c.dialTransmitterReceiver()
+	} else {
+		c.transceiver, err = c.dial(smpp.BIND_TRANSCEIVER)
+	}
 
 	if err == nil {
 		atomic.StoreInt32(&c.connected, 1)
+		c.startWatch()
 		zap.L().Info("Connection succeeded")
 	} else {
 		atomic.StoreInt32(&c.connected, 0)
@@ -184,93 +347,322 @@ func (c *smppClient) IsConnected() bool {
 	return atomic.LoadInt32(&c.connected) == 1
 }
 
-func (c *smppClient) SendMessage(id uint32, from, phone, text string) error {
+func (c *smppClient) SendMessage(id uint32, from, phone, text string, options model.SubmitOptions) (err error) {
 	//impose tps limit
 	c.rateLimiter.Wait(context.Background())
 
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
 	defer func() {
 		r := recover()
 		if r != nil {
 			zap.L().Error("Recovered in SendMessage")
 			atomic.StoreInt32(&c.connected, 0)
+			//the message must stay queued
+			err = errors.New("Failed to send message")
 		}
 	}()
 
-	//determine encoding
-	msgEncoding := smpp.ENCODING_DEFAULT
-	textBytes := []byte(text)
-	partLength := 153
-	maxLength := 160
-	if !util.IsASCII(text) {
-		msgEncoding = smpp.ENCODING_ISO10646
-		textBytes = gsmutil.EncodeUcs2(text)
-		partLength = 134
-		maxLength = 140
+	source := c.source(from)
+	concat := concatenation{mode: c.concatMode}
+	var msgEncoding int
+	var parts [][]byte
+	//user data header elements other than concatenation
+	var elements []byte
+	if options.Binary {
+		var data []byte
+		data, err = hex.DecodeString(text)
+		if err != nil {
+			return err
+		}
+		msgEncoding = int(dataCodingOctet)
+		if hasPorts(options.SourcePort, options.DestinationPort) {
+			elements = portIe(options.SourcePort, options.DestinationPort)
+		}
+		parts = binaryParts(data, len(elements), concat.ieLen())
+	} else {
+		msgEncoding, parts = textParts(text, concat.ieLen())
+	}
+
+	//long message is sent in message_payload as a single part
+	usePayload := len(parts) > 1 && concat.mode == CONCAT_PAYLOAD
+	if usePayload {
+		parts = [][]byte{bytes.Join(parts, nil)}
 	}
 
-	textBytesLen := len(textBytes)
+	partsCount := len(parts)
+	if partsCount > 1 {
+		concat.ref = c.nextRef(phone)
+	}
+	parts = concat.withUdh(parts, elements)
+	hasUdh := (partsCount > 1 && concat.mode != CONCAT_SAR) || len(elements) > 0
+
+	for i, part := range parts {
+		partNo := i + 1
+		params := submitParams(source, options, msgEncoding, partsCount)
+		if hasUdh {
+			params[smpp.ESM_CLASS] = smpp.ESM_CLASS_GSMFEAT_UDHI
+		}
 
-	if textBytesLen > maxLength {
-		partsCount := int(math.Ceil(float64(textBytesLen) / float64(partLength)))
+		tlvs := concat.tlvs(partsCount, partNo)
+		if usePayload {
+			tlvs = map[uint16][]byte{smpp.MESSAGE_PAYLOAD: part}
+			part = []byte{}
+		}
 
-		commonId := make([]byte, 1)
-		_, err := rand.Read(commonId)
+		//every part is tracked by its own sequence number
+		segment := SubmitResult{Id: id, PartNo: partNo, PartsCount: partsCount}
+		err := c.submit(inflightSubmit{segment: segment, from: source.addr, phone: phone, part: part, params: params,
+			tlvs: tlvs, attempts: 1})
 		if err != nil {
-			zap.L().Warn("Error generating common sms id", zap.Error(err))
+			if partNo == 1 {
+				//nothing is sent yet, the whole message can be retried
+				return err
+			}
+			//earlier parts are already sent, report the part as failed instead of resending them
+			zap.L().Error("Error sending submit_sm", zap.Error(err))
+			segment.Status = uint32(smpp.ESME_RSUBMITFAIL)
+			if c.submitSmHandler != nil {
+				go c.submitSmHandler(segment)
+			}
+		}
+	}
+
+	return nil
+}
+
+// submitParams returns submit_sm parameters of every part of a message
+func submitParams(source address, options model.SubmitOptions, dataCoding, partsCount int) smpp.Params {
+	params := smpp.Params{
+		smpp.SOURCE_ADDR_TON:     source.ton,
+		smpp.SOURCE_ADDR_NPI:     source.npi,
+		smpp.DEST_ADDR_TON:       destAddrTon,
+		smpp.DEST_ADDR_NPI:       destAddrNpi,
+		smpp.REGISTERED_DELIVERY: 1,
+		smpp.DATA_CODING:         dataCoding,
+	}
+
+	switch options.Class {
+	case model.CLASS_FLASH:
+		//message class 0 with the same alphabet
+		params[smpp.DATA_CODING] = dataCoding | dataCodingClass0
+	case model.CLASS_SILENT:
+		params[smpp.PROTOCOL_ID] = protocolIdType0
+	}
+
+	if !options.ValidityPeriod.IsZero() {
+		params[smpp.VALIDITY_PERIOD] = formatSmppTime(options.ValidityPeriod)
+	}
+	if !options.DeliverAt.IsZero() {
+		params[smpp.SCHEDULE_DELIVERY_TIME] = formatSmppTime(options.DeliverAt)
+	}
+	if options.Priority > 0 {
+		params[smpp.PRIORITY_FLAG] = options.Priority
+	}
+	if options.ProtocolId > 0 && options.Class != model.CLASS_SILENT {
+		params[smpp.PROTOCOL_ID] = options.ProtocolId
+	}
+	//parts of a concatenated message would replace each other
+	if options.ReplaceIfPresent && partsCount == 1 {
+		params[smpp.REPLACE_IF_PRESENT_FLAG] = 1
+	}
+
+	return params
+}
+
+// submit sends the part and adds it to the in-flight table,
+// blocks while the window of outstanding submits is full
+func (c *smppClient) submit(submit inflightSubmit) error {
+	if c.window != nil {
+		c.window <- struct{}{}
+	}
+	//once the part is in flight its slot is released by removing it from the table
+	tracked := false
+	defer func() {
+		if !tracked {
+			c.releaseSlot()
+		}
+	}()
+
+	//response may arrive right after the write, so the part is added beforehand
+	seq := c.transceiver.NextSeq()
+	c.inflightMu.Lock()
+	if c.inflight == nil {
+		c.inflight = make(map[uint32]inflightSubmit)
+	}
+	submit.sentAt = time.Now()
+	c.inflight[seq] = submit
+	tracked = true
+	c.inflightMu.Unlock()
+
+	err := c.transceiver.SubmitSmEncoded(seq, submit.from, submit.phone, submit.part, &submit.params, submit.tlvs)
+	if err != nil {
+		c.complete(seq)
+	}
+
+	return err
+}
+
+// complete removes and returns the part submitted with the sequence number
+func (c *smppClient) complete(seq uint32) (inflightSubmit, bool) {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	submit, ok := c.inflight[seq]
+	if ok {
+		delete(c.inflight, seq)
+		c.releaseSlot()
+	}
+	return submit, ok
+}
+
+// expireInflight removes and returns parts sent earlier than submitTimeout before now
+func (c *smppClient) expireInflight(now time.Time) []SubmitResult {
+	return c.removeInflight(func(submit inflightSubmit) bool {
+		return now.Sub(submit.sentAt) >= c.submitTimeout
+	})
+}
+
+// removeInflight removes parts matching the filter and returns them
+func (c *smppClient) removeInflight(filter func(submit inflightSubmit) bool) []SubmitResult {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+
+	var removed []SubmitResult
+	for seq, submit := range c.inflight {
+		if filter(submit) {
+			delete(c.inflight, seq)
+			c.releaseSlot()
+			removed = append(removed, submit.segment)
+		}
+	}
+	return removed
+}
+
+// reportFailed reports the part as failed without response
+func (c *smppClient) reportFailed(segment SubmitResult) {
+	segment.Status = uint32(smpp.ESME_RSUBMITFAIL)
+	if c.submitSmHandler != nil {
+		go c.submitSmHandler(segment)
+	}
+}
+
+// startWatch starts watch of the connection unless it is running
+func (c *smppClient) startWatch() {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	if c.watchStop == nil {
+		c.watchStop = make(chan struct{})
+		go c.watch(c.watchStop)
+	}
+}
+
+func (c *smppClient) stopWatch() {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	if c.watchStop != nil {
+		close(c.watchStop)
+		c.watchStop = nil
+	}
+}
+
+// watch reports submits left without response, restores send rate after throttling
+// and delivers concatenated inbound messages whose parts are missing until stop is closed
+func (c *smppClient) watch(stop <-chan struct{}) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		c.recoverRate(time.Now())
+
+		for _, msg := range c.inbound.expire(time.Now()) {
+			c.deliverInbound(msg)
 		}
 
-		for i := 1; i <= partsCount; i++ {
-			partNo := i
-			finalPart := i == partsCount
-			part := []byte{0x05, 0x00, 0x03, commonId[0], byte(partsCount), byte(partNo)}
-			var registeredDelivery int
-			if finalPart {
-				part = append(part, textBytes[(i-1)*partLength:]...)
-				//set id
-				c.transceiver.SetNextId(id)
-				registeredDelivery = 1
-			} else {
-				part = append(part, textBytes[(i-1)*partLength:i*partLength]...)
-				//set id
-				c.transceiver.SetNextId(0)
-				registeredDelivery = 0
+		for _, segment := range c.expireInflight(time.Now()) {
+			zap.L().Warn("No submit_sm_resp received", zap.Uint32("id", segment.Id), zap.Int("part", segment.PartNo))
+			c.reportFailed(segment)
+		}
+	}
+}
+
+// resubmit sends the part again after exponential backoff
+func (c *smppClient) resubmit(submit inflightSubmit) {
+	backoff := retryBackoff << uint(submit.attempts-1)
+	zap.L().Info("Resubmitting part", zap.Uint32("id", submit.segment.Id), zap.Int("part", submit.segment.PartNo), zap.Duration("backoff", backoff))
+
+	time.AfterFunc(backoff, func() {
+		defer func() {
+			r := recover()
+			if r != nil {
+				zap.L().Error("Recovered in resubmit")
 			}
+		}()
 
-			//send
-			_, err := c.transceiver.SubmitSmEncoded(from, phone, part, &smpp.Params{
-				smpp.SOURCE_ADDR_TON:     5,
-				smpp.SOURCE_ADDR_NPI:     1,
-				smpp.DEST_ADDR_TON:       1,
-				smpp.DEST_ADDR_NPI:       1,
-				smpp.ESM_CLASS:           smpp.ESM_CLASS_GSMFEAT_UDHI,
-				smpp.REGISTERED_DELIVERY: registeredDelivery,
-				smpp.DATA_CODING:         msgEncoding,
-			})
-
-			if finalPart {
-				return err
-			} else if err != nil {
-				zap.L().Error("Error sending submit_sm", zap.Error(err))
+		c.rateLimiter.Wait(context.Background())
+
+		submit.attempts++
+		err := c.submit(submit)
+		if err != nil {
+			zap.L().Error("Error resubmitting submit_sm", zap.Error(err))
+			submit.segment.Status = uint32(smpp.ESME_RSUBMITFAIL)
+			if c.submitSmHandler != nil {
+				c.submitSmHandler(submit.segment)
 			}
 		}
+	})
+}
 
-	} else {
-		//set id
-		c.transceiver.SetNextId(id)
-		//send
-		_, err := c.transceiver.SubmitSmEncoded(from, phone, textBytes, &smpp.Params{
-			smpp.SOURCE_ADDR_TON:     5,
-			smpp.SOURCE_ADDR_NPI:     1,
-			smpp.DEST_ADDR_TON:       1,
-			smpp.DEST_ADDR_NPI:       1,
-			smpp.REGISTERED_DELIVERY: 1,
-			smpp.DATA_CODING:         msgEncoding,
-		})
+// throttle halves the send rate, it is raised back by recoverRate
+func (c *smppClient) throttle() {
+	c.throttleMu.Lock()
+	defer c.throttleMu.Unlock()
 
-		return err
+	limit := c.rateLimiter.Limit() / 2
+	if limit < 1 {
+		limit = 1
 	}
+	c.rateLimiter.SetLimit(limit)
+	c.throttledAt = time.Now()
 
-	return nil
+	zap.L().Warn("SMSC throttles submits, send rate is reduced", zap.Float64("tps", float64(limit)))
+}
+
+// recoverRate doubles the send rate every throttleCooldown without throttling until tps is reached
+func (c *smppClient) recoverRate(now time.Time) {
+	c.throttleMu.Lock()
+	defer c.throttleMu.Unlock()
+
+	limit := c.rateLimiter.Limit()
+	if limit >= rate.Limit(c.tps) || now.Sub(c.throttledAt) < throttleCooldown {
+		return
+	}
+
+	limit *= 2
+	if limit > rate.Limit(c.tps) {
+		limit = rate.Limit(c.tps)
+	}
+	c.rateLimiter.SetLimit(limit)
+	c.throttledAt = now
+}
+
+func isTransient(status smpp.CMDStatus) bool {
+	return transientStatuses[status]
+}
+
+func (c *smppClient) releaseSlot() {
+	if c.window != nil {
+		<-c.window
+	}
 }
 
 func (c *smppClient) ReadPacket() error {
@@ -283,26 +675,44 @@ func (c *smppClient) ReadPacket() error {
 		}
 	}()
 
-	pdu, err := c.transceiver.Read() // This is blocking
+	err := c.read(c.transceiver)
 	if err != nil {
 		if _, ok := err.(smpp.SmppErr); !ok {
 			//set connected to false
 			atomic.StoreInt32(&c.connected, 0)
 		}
+	}
+	return err
+}
+
+// read blocks until a PDU is read from the bind and processes it
+func (c *smppClient) read(transceiver TransceiverWrapper) error {
+	pdu, err := transceiver.Read() // This is blocking
+	if err != nil {
 		return err
 	}
 
 	// Transceiver auto handles EnquireLinks
 	switch pdu.GetHeader().Id {
 	case smpp.SUBMIT_SM_RESP:
-		//received submit_sm_resp
 		c.processSubmitSmResp(pdu)
 
+	case smpp.GENERIC_NACK:
+		//generic_nack may reject cancel_sm, replace_sm and query_sm as well as submit_sm
+		if !c.completeOperation(pdu) {
+			c.processSubmitSmResp(pdu)
+		}
+
+	case smpp.CANCEL_SM_RESP, smpp.REPLACE_SM_RESP, smpp.QUERY_SM_RESP:
+		if !c.completeOperation(pdu) {
+			zap.L().Warn("Response to unknown operation", zap.Uint32("seq", pdu.GetHeader().Sequence), zap.Uint32("command", uint32(pdu.GetHeader().Id)))
+		}
+
 	case smpp.DELIVER_SM:
 		// received deliver_sm
 
 		//send deliverSmResp
-		err = c.transceiver.DeliverSmResp(pdu.GetHeader().Sequence, smpp.ESME_ROK)
+		err = transceiver.DeliverSmResp(pdu.GetHeader().Sequence, smpp.ESME_ROK)
 		if err != nil {
 			zap.L().Error("Error sending DeliverSmResp:", zap.Error(err))
 		}
@@ -316,27 +726,102 @@ func (c *smppClient) ReadPacket() error {
 
 func (c *smppClient) processSubmitSmResp(pdu smpp.Pdu) {
 	seqId := pdu.GetHeader().Sequence
-	if seqId == 0 {
+	submit, ok := c.complete(seqId)
+	if !ok {
+		zap.L().Warn("Response to unknown submit", zap.Uint32("seq", seqId), zap.Uint32("command", uint32(pdu.GetHeader().Id)))
 		return
 	}
-	submitStatus := uint32(pdu.GetHeader().Status)
-	msgId := pdu.GetField("message_id").String()
 
-	go c.submitSmHandler(seqId, submitStatus, msgId)
+	status := pdu.GetHeader().Status
+	if status == smpp.ESME_RTHROTTLED {
+		c.throttle()
+	}
+	if isTransient(status) && submit.attempts < maxSubmitAttempts {
+		if c.submitSmHandler != nil {
+			retry := submit.segment
+			retry.Status = uint32(status)
+			retry.Retry = true
+			go c.submitSmHandler(retry)
+		}
+		c.resubmit(submit)
+		return
+	}
+
+	segment := submit.segment
+	segment.Status = uint32(status)
+	//generic_nack has no message id
+	if messageId := pdu.GetField("message_id"); messageId != nil {
+		segment.SmscId = messageId.String()
+	}
 
-	zap.L().Debug("SubmitSmResp", zap.Uint32("id", seqId), zap.String("smsc-id", msgId), zap.Uint32("submit status", submitStatus))
+	go c.submitSmHandler(segment)
+
+	zap.L().Debug("SubmitSmResp", zap.Uint32("id", segment.Id), zap.Int("part", segment.PartNo), zap.String("smsc-id", segment.SmscId), zap.Uint32("submit status", segment.Status))
 }
 
 func (c *smppClient) processDeliverSm(pdu smpp.Pdu) {
-	dlvSm := pdu.GetField("short_message").String()
+	if !isReceipt(fieldUint8(pdu, smpp.ESM_CLASS)) {
+		c.processInbound(pdu)
+		return
+	}
 
-	res := dlvRctRx.FindAllStringSubmatch(dlvSm, -1)
-	if len(res) != 1 || len(res[0]) != 3 {
-		zap.L().Warn("Failed to parse deliver_sm", zap.String("deliver-sm", dlvSm))
+	receipt, ok := parseReceipt(pdu)
+	if !ok {
+		zap.L().Warn("Failed to parse deliver_sm", zap.String("deliver-sm", pdu.GetField(smpp.SHORT_MESSAGE).String()))
 		return
 	}
 
-	go c.deliverHandler(res[0][1], res[0][2])
+	go c.deliverHandler(receipt)
+
+	zap.L().Debug("DeliverSm", zap.String("smsc-id", receipt.SmscId), zap.String("delivery status", receipt.Status), zap.String("error code", receipt.ErrorCode))
+}
+
+// textParts encodes the text and splits it into parts leaving room for concatenation element of ieLen octets
+// if it does not fit one part, GSM 03.38 septets are sent unpacked so lengths are in septets
+func textParts(text string, ieLen int) (int, [][]byte) {
+	udhLen := 1 + ieLen
+	msgEncoding := smpp.ENCODING_DEFAULT
+	textBytes, isGsm := encodeGsm7(text)
+	partLength := (maxShortMessageLength - udhLen) * 8 / 7
+	maxLength := 160
+	if !isGsm {
+		msgEncoding = smpp.ENCODING_ISO10646
+		textBytes = gsmutil.EncodeUcs2(text)
+		//whole UTF-16 code units only
+		partLength = (maxShortMessageLength - udhLen) &^ 1
+		maxLength = maxShortMessageLength
+	}
+
+	if len(textBytes) <= maxLength {
+		return msgEncoding, [][]byte{textBytes}
+	}
+
+	return msgEncoding, splitParts(textBytes, partLength, msgEncoding == smpp.ENCODING_ISO10646)
+}
+
+// splitParts splits encoded text into parts of at most partLength octets
+// without cutting GSM escape sequences or UTF-16 surrogate pairs
+func splitParts(textBytes []byte, partLength int, ucs2 bool) [][]byte {
+	var parts [][]byte
+	for len(textBytes) > partLength {
+		end := partLength
+		if ucs2 {
+			//high surrogate must stay with its low surrogate
+			if end >= 2 && isHighSurrogate(textBytes[end-2], textBytes[end-1]) {
+				end -= 2
+			}
+		} else if textBytes[end-1] == gsmEscape {
+			//escape must stay with the extension character code
+			end--
+		}
+		parts = append(parts, textBytes[:end])
+		textBytes = textBytes[end:]
+	}
+
+	return append(parts, textBytes)
+}
 
-	zap.L().Debug("DeliverSm", zap.String("smsc-id", res[0][1]), zap.String("delivery status", res[0][2]))
+func isHighSurrogate(hi, lo byte) bool {
+	unit := uint16(hi)<<8 | uint16(lo)
+	return unit >= 0xD800 && unit <= 0xDBFF
 }
@@ -1,13 +1,20 @@
 package sms
 
 import (
+	"bytes"
 	"errors"
+	"io"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Dilshat/smpp34"
+	"github.com/Dilshat/smpp34/gsmutil"
 	"github.com/dchest/uniuri"
+	"github.com/dilshat/sms-sender/model"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/time/rate"
 )
@@ -22,8 +29,10 @@ var (
 	unbound           bool
 	closed            bool
 	nextId            uint32
-	submitCount       int
+	submitCount       int32
 	deliverSmRespSent bool
+	boundAs           []smpp34.CMDId
+	replacedMessage   []byte
 )
 
 func TestSmppClient_ReadPacket(t *testing.T) {
@@ -38,60 +47,373 @@ func TestSmppClient_ReadPacket(t *testing.T) {
 	pdu := mockPdu{header: &smpp34.Header{Id: smpp34.SUBMIT_SM_RESP, Sequence: SEQ, Status: 0},
 		field: mockField{str: "1203837180"}}
 	smppClnt = smppClient{transceiver: transceiverWrapperMock{pdu: pdu}}
-	f := func(id, status uint32, smscId string) {}
-	smppClnt.BindSubmitSmResponseHandler(f)
+	results := make(chan SubmitResult, 1)
+	smppClnt.BindSubmitSmResponseHandler(func(result SubmitResult) {
+		results <- result
+	})
+	smppClnt.inflight = map[uint32]inflightSubmit{SEQ: {segment: SubmitResult{Id: 123, PartNo: 2, PartsCount: 3}}}
 
 	err = smppClnt.ReadPacket()
 
 	require.NoError(t, err)
+	result := <-results
+	require.Equal(t, uint32(123), result.Id)
+	require.Equal(t, 2, result.PartNo)
+	require.Equal(t, "1203837180", result.SmscId)
+	_, inflight := smppClnt.complete(SEQ)
+	require.False(t, inflight)
 
 	//DELIVER_SM
 	deliverSmRespSent = false
-	pdu = mockPdu{header: &smpp34.Header{Id: smpp34.DELIVER_SM},
-		field: mockField{str: "id:1203837180  sub:001 dlvrd:1  submit date:1911251537 done date:1911251537 stat:DELIVRD err:000  TEXT:a message space. What is up bro?"}}
-	smppClnt = smppClient{transceiver: transceiverWrapperMock{pdu: pdu}}
-	f2 := func(smscId string, status string) {}
-	smppClnt.BindDeliverSmHandler(f2)
+	pdu2, _ := smpp34.NewDeliverSm(&smpp34.Header{Id: smpp34.DELIVER_SM}, []byte{})
+	_ = pdu2.SetField(smpp34.ESM_CLASS, 0x04)
+	_ = pdu2.SetField(smpp34.SHORT_MESSAGE, "id:1203837180  sub:001 dlvrd:1  submit date:1911251537 done date:1911251537 stat:DELIVRD err:000  TEXT:a message space. What is up bro?")
+	smppClnt = smppClient{transceiver: transceiverWrapperMock{pdu: pdu2}}
+	receipts := make(chan Receipt, 1)
+	smppClnt.BindDeliverSmHandler(func(receipt Receipt) {
+		receipts <- receipt
+	})
+
+	err = smppClnt.ReadPacket()
+
+	require.NoError(t, err)
+	require.True(t, deliverSmRespSent)
+	receipt := <-receipts
+	require.Equal(t, "1203837180", receipt.SmscId)
+	require.Equal(t, "DELIVRD", receipt.Status)
+	require.Equal(t, "000", receipt.ErrorCode)
+
+	//mobile originated message
+	deliverSmRespSent = false
+	pdu2, _ = smpp34.NewDeliverSm(&smpp34.Header{Id: smpp34.DELIVER_SM}, []byte{})
+	_ = pdu2.SetField(smpp34.SOURCE_ADDR, PHONE)
+	_ = pdu2.SetField(smpp34.DESTINATION_ADDR, SENDER)
+	_ = pdu2.SetField(smpp34.DATA_CODING, 0x08)
+	_ = pdu2.SetField(smpp34.SHORT_MESSAGE, string(gsmutil.EncodeUcs2("Привет")))
+	smppClnt = smppClient{transceiver: transceiverWrapperMock{pdu: pdu2}}
+	inbound := make(chan InboundMessage, 1)
+	smppClnt.BindInboundHandler(func(msg InboundMessage) {
+		inbound <- msg
+	})
 
 	err = smppClnt.ReadPacket()
 
 	require.NoError(t, err)
 	require.True(t, deliverSmRespSent)
+	msg := <-inbound
+	require.Equal(t, PHONE, msg.Source)
+	require.Equal(t, SENDER, msg.Destination)
+	require.Equal(t, "Привет", msg.Text)
 }
 
 func TestSmppClient_SendMessage(t *testing.T) {
 	nextId = 0
-	submitCount = 0
+	atomic.StoreInt32(&submitCount, 0)
 	smppClnt := smppClient{transceiver: transceiverWrapperMock{}, rateLimiter: rate.NewLimiter(rate.Limit(1), 1)}
 
-	err := smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10))
+	err := smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10), model.SubmitOptions{})
 
 	require.NoError(t, err)
-	require.Equal(t, SEQ, nextId)
-	require.Equal(t, 1, submitCount)
+	require.Equal(t, uint32(1), nextId)
+	require.Equal(t, int32(1), atomic.LoadInt32(&submitCount))
 
-	submitCount = 0
-	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(400))
+	//every part is submitted with its own sequence number
+	atomic.StoreInt32(&submitCount, 0)
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(400), model.SubmitOptions{})
 
 	require.NoError(t, err)
-	require.Equal(t, 3, submitCount)
+	require.Equal(t, int32(3), atomic.LoadInt32(&submitCount))
+	require.Equal(t, uint32(4), nextId)
+	for seq := uint32(2); seq <= 4; seq++ {
+		submit, ok := smppClnt.complete(seq)
+		segment := submit.segment
+		require.True(t, ok)
+		require.Equal(t, SEQ, segment.Id)
+		require.Equal(t, int(seq-1), segment.PartNo)
+		require.Equal(t, 3, segment.PartsCount)
+	}
+
+	atomic.StoreInt32(&submitCount, 0)
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(100)+"привет", model.SubmitOptions{})
 
-	submitCount = 0
-	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(100)+"привет")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&submitCount))
+
+	//GSM 03.38 characters do not switch to UCS-2
+	atomic.StoreInt32(&submitCount, 0)
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(150)+"é£ñ", model.SubmitOptions{})
+
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&submitCount))
+
+	//extension characters take two septets
+	atomic.StoreInt32(&submitCount, 0)
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(155)+"€€€", model.SubmitOptions{})
 
 	require.NoError(t, err)
-	require.Equal(t, 2, submitCount)
+	require.Equal(t, int32(2), atomic.LoadInt32(&submitCount))
+
+	//16-bit reference leaves one septet less per part
+	atomic.StoreInt32(&submitCount, 0)
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(305), model.SubmitOptions{})
+
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&submitCount))
+
+	atomic.StoreInt32(&submitCount, 0)
+	smppClnt.concatMode = CONCAT_UDH16
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(305), model.SubmitOptions{})
+
+	require.NoError(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&submitCount))
+	smppClnt.concatMode = ""
+
+	//whole long message in message_payload
+	atomic.StoreInt32(&submitCount, 0)
+	smppClnt.concatMode = CONCAT_PAYLOAD
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(400), model.SubmitOptions{})
+
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&submitCount))
+	smppClnt.concatMode = ""
+
+	//binary data with port addressing
+	atomic.StoreInt32(&submitCount, 0)
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, strings.Repeat("ab", 200), model.SubmitOptions{Binary: true, DestinationPort: 2948})
+
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&submitCount))
+
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, "not hex", model.SubmitOptions{Binary: true})
+
+	require.Error(t, err)
+
+	//panic is reported as failure so that the message stays queued
+	smppClnt.transceiver = nil
+
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10), model.SubmitOptions{})
+
+	require.Error(t, err)
+	require.False(t, smppClnt.IsConnected())
+}
+
+func TestSubmitParams(t *testing.T) {
+	validityPeriod := time.Date(2020, 4, 2, 11, 33, 6, 0, time.UTC)
+	options := model.SubmitOptions{ValidityPeriod: validityPeriod, Priority: 2, ProtocolId: 64, ReplaceIfPresent: true}
+
+	params := submitParams(address{ton: tonInternational, npi: npiIsdn}, options, smpp34.ENCODING_DEFAULT, 1)
+
+	require.Equal(t, tonInternational, params[smpp34.SOURCE_ADDR_TON])
+	require.Equal(t, npiIsdn, params[smpp34.SOURCE_ADDR_NPI])
+
+	require.Equal(t, "200402113306000+", params[smpp34.VALIDITY_PERIOD])
+	require.Equal(t, 2, params[smpp34.PRIORITY_FLAG])
+	require.Equal(t, 64, params[smpp34.PROTOCOL_ID])
+	require.Equal(t, 1, params[smpp34.REPLACE_IF_PRESENT_FLAG])
+	require.NotContains(t, params, smpp34.SCHEDULE_DELIVERY_TIME)
+
+	//parts of a concatenated message are not replaced
+	params = submitParams(address{}, options, smpp34.ENCODING_DEFAULT, 2)
+
+	require.NotContains(t, params, smpp34.REPLACE_IF_PRESENT_FLAG)
+
+	//flash messages keep the alphabet
+	params = submitParams(address{}, model.SubmitOptions{Class: model.CLASS_FLASH}, smpp34.ENCODING_DEFAULT, 2)
+
+	require.Equal(t, 0x10, params[smpp34.DATA_CODING])
+
+	params = submitParams(address{}, model.SubmitOptions{Class: model.CLASS_FLASH}, smpp34.ENCODING_ISO10646, 1)
+
+	require.Equal(t, 0x18, params[smpp34.DATA_CODING])
+
+	params = submitParams(address{}, model.SubmitOptions{Class: model.CLASS_SILENT, ProtocolId: 1}, smpp34.ENCODING_ISO10646, 1)
+
+	require.Equal(t, 0x40, params[smpp34.PROTOCOL_ID])
+	require.Equal(t, smpp34.ENCODING_ISO10646, params[smpp34.DATA_CODING])
+}
+
+func TestSmppClient_SendMessageWindow(t *testing.T) {
+	nextId = 0
+	smppClnt := smppClient{transceiver: transceiverWrapperMock{}, rateLimiter: rate.NewLimiter(rate.Inf, 1), window: make(chan struct{}, 2)}
+
+	_ = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10), model.SubmitOptions{})
+	_ = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10), model.SubmitOptions{})
+
+	//window is full, the next submit waits for a response
+	sent := make(chan error)
+	go func() {
+		sent <- smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10), model.SubmitOptions{})
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("submit must wait for a free slot")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	_, ok := smppClnt.complete(1)
+	require.True(t, ok)
+	require.NoError(t, <-sent)
+
+	//failed submit frees its slot
+	_, _ = smppClnt.complete(2)
+	smppClnt.transceiver = transceiverWrapperMock{err: errors.New("broken pipe")}
+
+	err := smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10), model.SubmitOptions{})
+
+	require.Error(t, err)
+	require.Equal(t, 1, len(smppClnt.window))
+	require.Equal(t, 1, len(smppClnt.inflight))
+
+	//slot is freed if submit panics before the part is in flight
+	smppClnt.transceiver = nil
+
+	err = smppClnt.SendMessage(SEQ, SENDER, PHONE, uniuri.NewLen(10), model.SubmitOptions{})
+
+	require.Error(t, err)
+	require.Equal(t, 1, len(smppClnt.window))
+}
+
+func TestSmppClient_expireInflight(t *testing.T) {
+	smppClnt := smppClient{submitTimeout: time.Minute, window: make(chan struct{}, 2)}
+	now := time.Now()
+	smppClnt.window <- struct{}{}
+	smppClnt.window <- struct{}{}
+	smppClnt.inflight = map[uint32]inflightSubmit{
+		1: {segment: SubmitResult{Id: 1}, sentAt: now.Add(-time.Minute * 2)},
+		2: {segment: SubmitResult{Id: 2}, sentAt: now},
+	}
+
+	expired := smppClnt.expireInflight(now)
+
+	require.Equal(t, 1, len(expired))
+	require.Equal(t, uint32(1), expired[0].Id)
+	require.Equal(t, 1, len(smppClnt.inflight))
+	require.Equal(t, 1, len(smppClnt.window))
+}
+
+func TestSmppClient_processSubmitSmResp(t *testing.T) {
+	atomic.StoreInt32(&submitCount, 0)
+	smppClnt := smppClient{transceiver: transceiverWrapperMock{}, rateLimiter: rate.NewLimiter(rate.Limit(100), 1), tps: 100}
+	results := make(chan SubmitResult, 1)
+	smppClnt.BindSubmitSmResponseHandler(func(result SubmitResult) {
+		results <- result
+	})
+
+	//throttled submit is resubmitted with a reduced rate
+	smppClnt.inflight = map[uint32]inflightSubmit{SEQ: {segment: SubmitResult{Id: 123, PartNo: 1, PartsCount: 1}, attempts: 1}}
+	nack := mockPdu{header: &smpp34.Header{Id: smpp34.GENERIC_NACK, Sequence: SEQ, Status: smpp34.ESME_RTHROTTLED}}
+
+	smppClnt.processSubmitSmResp(nack)
+
+	require.Equal(t, rate.Limit(50), smppClnt.rateLimiter.Limit())
+	//retry is reported as well
+	retry := <-results
+	require.True(t, retry.Retry)
+	require.Equal(t, uint32(smpp34.ESME_RTHROTTLED), retry.Status)
+	waitFor(t, func() bool {
+		smppClnt.inflightMu.Lock()
+		defer smppClnt.inflightMu.Unlock()
+		return atomic.LoadInt32(&submitCount) == 1 && len(smppClnt.inflight) == 1
+	}, time.Second*3)
+
+	//the last attempt is reported
+	smppClnt.inflight = map[uint32]inflightSubmit{SEQ: {segment: SubmitResult{Id: 123, PartNo: 1, PartsCount: 1}, attempts: maxSubmitAttempts}}
+	resp := mockPdu{header: &smpp34.Header{Id: smpp34.SUBMIT_SM_RESP, Sequence: SEQ, Status: smpp34.ESME_RMSGQFUL}, field: mockField{str: ""}}
+
+	smppClnt.processSubmitSmResp(resp)
+
+	require.Equal(t, uint32(smpp34.ESME_RMSGQFUL), (<-results).Status)
+
+	//permanent failure is reported at once
+	smppClnt.inflight = map[uint32]inflightSubmit{SEQ: {segment: SubmitResult{Id: 123, PartNo: 1, PartsCount: 1}, attempts: 1}}
+	resp = mockPdu{header: &smpp34.Header{Id: smpp34.SUBMIT_SM_RESP, Sequence: SEQ, Status: smpp34.ESME_RINVDSTADR}, field: mockField{str: ""}}
+
+	smppClnt.processSubmitSmResp(resp)
+
+	require.Equal(t, uint32(smpp34.ESME_RINVDSTADR), (<-results).Status)
+}
+
+func TestSmppClient_recoverRate(t *testing.T) {
+	smppClnt := smppClient{rateLimiter: rate.NewLimiter(rate.Limit(100), 1), tps: 100}
+
+	smppClnt.throttle()
+	smppClnt.throttle()
+
+	require.Equal(t, rate.Limit(25), smppClnt.rateLimiter.Limit())
+
+	//rate is not raised during cooldown
+	smppClnt.recoverRate(time.Now())
+
+	require.Equal(t, rate.Limit(25), smppClnt.rateLimiter.Limit())
+
+	smppClnt.recoverRate(time.Now().Add(throttleCooldown))
+
+	require.Equal(t, rate.Limit(50), smppClnt.rateLimiter.Limit())
+
+	smppClnt.recoverRate(time.Now().Add(throttleCooldown * 2))
+	smppClnt.recoverRate(time.Now().Add(throttleCooldown * 3))
+
+	require.Equal(t, rate.Limit(100), smppClnt.rateLimiter.Limit())
+}
+
+func TestSplitParts(t *testing.T) {
+	//escape sequence on the border of parts
+	septets, _ := encodeGsm7(strings.Repeat("a", 152) + "€" + strings.Repeat("b", 10))
+	parts := splitParts(septets, 153, false)
+
+	require.Equal(t, 2, len(parts))
+	require.Equal(t, 152, len(parts[0]))
+	require.Equal(t, []byte{gsmEscape, 0x65}, parts[1][:2])
+
+	//surrogate pair on the border of parts
+	ucs2 := gsmutil.EncodeUcs2(strings.Repeat("ы", 66) + "😀" + "ы")
+	parts = splitParts(ucs2, 134, true)
+
+	require.Equal(t, 2, len(parts))
+	require.Equal(t, 132, len(parts[0]))
+	decoded, err := gsmutil.DecodeUcs2(parts[1])
+	require.NoError(t, err)
+	require.Equal(t, "😀ы", decoded)
+
+	//exact split
+	parts = splitParts(bytes.Repeat([]byte{0x61}, 306), 153, false)
+
+	require.Equal(t, 2, len(parts))
+	require.Equal(t, 153, len(parts[1]))
+}
+
+func TestNewClient(t *testing.T) {
+	client := NewClient(ClientConfig{}).(*smppClient)
+
+	//parts are not failed right after submit
+	require.Equal(t, defaultSubmitTimeout, client.submitTimeout)
+	//submits are allowed
+	require.Equal(t, rate.Limit(defaultTps), client.rateLimiter.Limit())
+	//TON/NPI are detected from the sender
+	require.Equal(t, -1, client.sourceTon)
+	require.Equal(t, -1, client.sourceNpi)
+	//nothing is watched before connect
+	require.Nil(t, client.watchStop)
+
+	ton := 0
+	client = NewClient(ClientConfig{SourceTon: &ton}).(*smppClient)
+
+	require.Equal(t, 0, client.sourceTon)
+	require.Equal(t, -1, client.sourceNpi)
 }
 
 func TestSmppClient_Reconnect(t *testing.T) {
 	unbound = false
 	closed = false
 	smppClnt := smppClient{connected: 0, transceiverFactory: transceiverWrapperFactoryMock{}}
+	defer smppClnt.Disconnect()
 
 	err := smppClnt.Reconnect()
 
 	require.NoError(t, err)
 	require.True(t, smppClnt.IsConnected())
+	require.NotNil(t, smppClnt.watchStop)
 }
 
 func TestSmppClient_Connect(t *testing.T) {
@@ -101,6 +423,12 @@ func TestSmppClient_Connect(t *testing.T) {
 
 	require.NoError(t, err)
 	require.True(t, smppClnt.IsConnected())
+	//connection is watched until disconnect
+	require.NotNil(t, smppClnt.watchStop)
+
+	smppClnt.Disconnect()
+
+	require.Nil(t, smppClnt.watchStop)
 
 	smppClnt.transceiverFactory = transceiverWrapperFactoryMock{err: errors.New("blablabla")}
 
@@ -108,6 +436,64 @@ func TestSmppClient_Connect(t *testing.T) {
 
 	require.Error(t, err)
 	require.False(t, smppClnt.IsConnected())
+	require.Nil(t, smppClnt.watchStop)
+}
+
+func TestSmppClient_ConnectTransmitterReceiver(t *testing.T) {
+	boundAs = nil
+	deliverSmRespSent = false
+	receiver := &transceiverWrapperMock{reads: make(chan smpp34.Pdu)}
+	smppClnt := smppClient{transceiverFactory: transceiverWrapperFactoryMock{receiver: receiver}, bind: BindConfig{Mode: BIND_MODE_TXRX}}
+	receipts := make(chan Receipt, 1)
+	smppClnt.BindDeliverSmHandler(func(receipt Receipt) {
+		receipts <- receipt
+	})
+
+	err := smppClnt.Connect()
+
+	require.NoError(t, err)
+	require.True(t, smppClnt.IsConnected())
+	require.Equal(t, []smpp34.CMDId{smpp34.BIND_TRANSMITTER, smpp34.BIND_RECEIVER}, boundAs)
+
+	//deliver_sm is read from the receiver bind and answered there
+	pdu, _ := smpp34.NewDeliverSm(&smpp34.Header{Id: smpp34.DELIVER_SM}, []byte{})
+	_ = pdu.SetField(smpp34.ESM_CLASS, 0x04)
+	_ = pdu.SetField(smpp34.SHORT_MESSAGE, "id:1203837180 sub:001 dlvrd:1 submit date:1911251537 done date:1911251537 stat:DELIVRD err:000 text:")
+	receiver.reads <- pdu
+
+	require.Equal(t, "1203837180", (<-receipts).SmscId)
+	require.True(t, deliverSmRespSent)
+
+	//broken receiver makes the client reconnect both binds
+	close(receiver.reads)
+
+	waitFor(t, func() bool { return !smppClnt.IsConnected() }, time.Second)
+
+	smppClnt.Disconnect()
+}
+
+// waitFor polls the condition until it holds, require.Eventually of testify 1.4 may send on its closed channel
+func waitFor(t *testing.T, condition func() bool, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition is not met in " + timeout.String())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestSmppClient_bindParams(t *testing.T) {
+	smppClnt := smppClient{smscAccount: "id", smscPassword: "pwd", bind: BindConfig{SystemType: "VMA", InterfaceVersion: 0x33, AddressRange: "1414"}}
+
+	params := smppClnt.bindParams()
+
+	require.Equal(t, smpp34.Params{smpp34.SYSTEM_ID: "id", smpp34.PASSWORD: "pwd", smpp34.SYSTEM_TYPE: "VMA", smpp34.INTERFACE_VERSION: 0x33, smpp34.ADDRESS_RANGE: "1414"}, params)
+
+	//optional parameters are not sent unless set
+	smppClnt.bind = BindConfig{}
+
+	require.Len(t, smppClnt.bindParams(), 2)
 }
 
 func TestSmppClient_IsConnected(t *testing.T) {
@@ -121,26 +507,47 @@ func TestSmppClient_IsConnected(t *testing.T) {
 }
 
 func TestSmppClient_Disconnect(t *testing.T) {
-	smppClnt := smppClient{transceiver: transceiverWrapperMock{}}
+	smppClnt := smppClient{transceiver: transceiverWrapperMock{}, window: make(chan struct{}, 2)}
+	results := make(chan SubmitResult, 1)
+	smppClnt.BindSubmitSmResponseHandler(func(result SubmitResult) {
+		results <- result
+	})
+	smppClnt.window <- struct{}{}
+	smppClnt.inflight = map[uint32]inflightSubmit{SEQ: {segment: SubmitResult{Id: 123, PartNo: 1, PartsCount: 1}}}
 
 	smppClnt.Disconnect()
 
 	require.True(t, unbound)
 	require.True(t, closed)
+	//parts in flight are failed and free their slots
+	result := <-results
+	require.Equal(t, uint32(123), result.Id)
+	require.Equal(t, uint32(smpp34.ESME_RSUBMITFAIL), result.Status)
+	require.Equal(t, 0, len(smppClnt.inflight))
+	require.Equal(t, 0, len(smppClnt.window))
 }
 
 func TestSmppClient_BindDeliverSmHandler(t *testing.T) {
 	smppClnt := smppClient{}
-	f := func(smscId string, status string) {}
+	f := func(receipt Receipt) {}
 
 	smppClnt.BindDeliverSmHandler(f)
 
 	require.Equal(t, runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name(), runtime.FuncForPC(reflect.ValueOf(smppClnt.deliverHandler).Pointer()).Name())
 }
 
+func TestSmppClient_BindInboundHandler(t *testing.T) {
+	smppClnt := smppClient{}
+	f := func(msg InboundMessage) {}
+
+	smppClnt.BindInboundHandler(f)
+
+	require.Equal(t, runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name(), runtime.FuncForPC(reflect.ValueOf(smppClnt.inboundHandler).Pointer()).Name())
+}
+
 func TestSmppClient_BindSubmitSmResponseHandler(t *testing.T) {
 	smppClnt := smppClient{}
-	f := func(id, status uint32, smscId string) {}
+	f := func(result SubmitResult) {}
 
 	smppClnt.BindSubmitSmResponseHandler(f)
 
@@ -216,15 +623,25 @@ func (m mockPdu) Ok() bool {
 
 type transceiverWrapperFactoryMock struct {
 	err error
+	//receiver is returned for bind_receiver
+	receiver TransceiverWrapper
 }
 
-func (t transceiverWrapperFactoryMock) GetTransceiver(host string, port int, eli int, bindParams smpp34.Params) (TransceiverWrapper, error) {
+func (t transceiverWrapperFactoryMock) GetTransceiver(host string, port int, eli int, bindId smpp34.CMDId, bindParams smpp34.Params) (TransceiverWrapper, error) {
+	boundAs = append(boundAs, bindId)
+	if bindId == smpp34.BIND_RECEIVER && t.receiver != nil {
+		return t.receiver, t.err
+	}
 	return transceiverWrapperMock{}, t.err
 }
 
 type transceiverWrapperMock struct {
 	pdu smpp34.Pdu
 	err error
+	//reads blocks Read until a PDU is sent, closing it breaks the connection
+	reads chan smpp34.Pdu
+	//respond is called with sequence number of cancel_sm, replace_sm and query_sm
+	respond func(seq uint32)
 }
 
 func (t transceiverWrapperMock) Unbind() error {
@@ -236,17 +653,47 @@ func (t transceiverWrapperMock) Close() {
 	closed = true
 }
 
-func (t transceiverWrapperMock) SetNextId(id uint32) {
-	nextId = id
+func (t transceiverWrapperMock) NextSeq() uint32 {
+	nextId++
+	return nextId
 }
 
 func (t transceiverWrapperMock) Read() (smpp34.Pdu, error) {
+	if t.reads != nil {
+		pdu, ok := <-t.reads
+		if !ok {
+			return nil, io.EOF
+		}
+		return pdu, nil
+	}
 	return t.pdu, t.err
 }
 
-func (t transceiverWrapperMock) SubmitSmEncoded(sourceAddr, destinationAddr string, shortMessage []byte, params *smpp34.Params) (seq uint32, err error) {
-	submitCount++
-	return SEQ, nil
+func (t transceiverWrapperMock) SubmitSmEncoded(seq uint32, sourceAddr, destinationAddr string, shortMessage []byte, params *smpp34.Params, tlvs map[uint16][]byte) error {
+	atomic.AddInt32(&submitCount, 1)
+	return t.err
+}
+
+func (t transceiverWrapperMock) CancelSm(seq uint32, smscId string, source address, destinationAddr string) error {
+	if t.respond != nil {
+		go t.respond(seq)
+	}
+	return t.err
+}
+
+func (t transceiverWrapperMock) ReplaceSm(seq uint32, smscId string, source address, shortMessage []byte) error {
+	replacedMessage = shortMessage
+	if t.respond != nil {
+		go t.respond(seq)
+	}
+	return t.err
+}
+
+func (t transceiverWrapperMock) QuerySm(seq uint32, smscId string, source address) error {
+	if t.respond != nil {
+		go t.respond(seq)
+	}
+	return t.err
 }
 
 func (t transceiverWrapperMock) DeliverSmResp(seq uint32, status smpp34.CMDStatus) error {
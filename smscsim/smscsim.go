@@ -0,0 +1,268 @@
+// Package smscsim implements a minimal SMPP 3.4 SMSC simulator
+// for local development and integration tests.
+package smscsim
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	smpp "github.com/Dilshat/smpp34"
+	"github.com/dilshat/sms-sender/sms"
+	"go.uber.org/zap"
+)
+
+const (
+	//receipt date format, see SMPP 3.4 Appendix B
+	receiptDateFormat = "0601021504"
+	//response command ids are request ids with the high bit set
+	respMask smpp.CMDId = 0x80000000
+)
+
+type Config struct {
+	//SystemId and Password are checked on bind, empty values accept any credentials
+	SystemId string
+	Password string
+	//SubmitStatus is the command status returned in every submit_sm_resp
+	SubmitStatus uint32
+	//Latency is the delay before submit_sm_resp is sent
+	Latency time.Duration
+	//ReceiptDelay is the delay between submit_sm_resp and delivery receipt
+	ReceiptDelay time.Duration
+	//ReceiptStat is the final status reported in delivery receipts, empty disables receipts
+	ReceiptStat string
+}
+
+type Simulator struct {
+	config   Config
+	listener net.Listener
+	msgId    uint64
+
+	mu       sync.Mutex
+	sessions map[*session]bool
+}
+
+type session struct {
+	conn  net.Conn
+	seq   uint32
+	bound bool
+	//bind type of the session and its system_id
+	transmits bool
+	receives  bool
+	systemId  string
+
+	mu sync.Mutex
+}
+
+func New(config Config) *Simulator {
+	return &Simulator{config: config, sessions: make(map[*session]bool)}
+}
+
+// Listen starts accepting ESME connections on the given address, e.g. ":2775"
+func (s *Simulator) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	go s.accept()
+
+	return nil
+}
+
+// Addr returns the address the simulator listens on
+func (s *Simulator) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the listener and drops all sessions
+func (s *Simulator) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+
+	return err
+}
+
+func (s *Simulator) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			//listener closed
+			return
+		}
+
+		sess := &session{conn: conn}
+		s.mu.Lock()
+		s.sessions[sess] = true
+		s.mu.Unlock()
+
+		go s.serve(sess)
+	}
+}
+
+func (s *Simulator) serve(sess *session) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+		sess.conn.Close()
+	}()
+
+	for {
+		pdu, header, err := sms.ReadPdu(sess.conn)
+		if err != nil {
+			if header == nil {
+				//connection closed or broken
+				return
+			}
+			zap.L().Warn("Unsupported PDU", zap.Error(err))
+			sess.writeGenericNack(header.Sequence, smpp.ESME_RINVCMDID)
+			continue
+		}
+
+		if !s.handle(sess, pdu) {
+			return
+		}
+	}
+}
+
+// handle processes incoming pdu and returns false if the session must be closed
+func (s *Simulator) handle(sess *session, pdu smpp.Pdu) bool {
+	header := pdu.GetHeader()
+
+	switch header.Id {
+	case smpp.BIND_TRANSCEIVER, smpp.BIND_TRANSMITTER, smpp.BIND_RECEIVER:
+		status := smpp.ESME_ROK
+		if !s.authenticate(pdu.GetField(smpp.SYSTEM_ID).String(), pdu.GetField(smpp.PASSWORD).String()) {
+			status = smpp.ESME_RBINDFAIL
+		}
+		resp, _ := (&smpp.Smpp{}).BindResp(header.Id|respMask, header.Sequence, status, "smscsim")
+		sess.write(resp)
+		s.mu.Lock()
+		sess.bound = status == smpp.ESME_ROK
+		sess.transmits = header.Id != smpp.BIND_RECEIVER
+		sess.receives = header.Id != smpp.BIND_TRANSMITTER
+		sess.systemId = pdu.GetField(smpp.SYSTEM_ID).String()
+		s.mu.Unlock()
+		return sess.bound
+
+	case smpp.ENQUIRE_LINK:
+		resp, _ := (&smpp.Smpp{}).EnquireLinkResp(header.Sequence)
+		sess.write(resp)
+
+	case smpp.UNBIND:
+		resp, _ := (&smpp.Smpp{}).UnbindResp(header.Sequence)
+		sess.write(resp)
+		return false
+
+	case smpp.SUBMIT_SM:
+		if !sess.bound || !sess.transmits {
+			sess.writeGenericNack(header.Sequence, smpp.ESME_RINVBNDSTS)
+			return true
+		}
+		go s.submit(sess, pdu)
+
+	case smpp.DELIVER_SM_RESP, smpp.ENQUIRE_LINK_RESP, smpp.UNBIND_RESP, smpp.GENERIC_NACK:
+		//nothing to do
+
+	default:
+		sess.writeGenericNack(header.Sequence, smpp.ESME_RINVCMDID)
+	}
+
+	return true
+}
+
+func (s *Simulator) authenticate(systemId, password string) bool {
+	if s.config.SystemId != "" && s.config.SystemId != systemId {
+		return false
+	}
+	return s.config.Password == "" || s.config.Password == password
+}
+
+func (s *Simulator) submit(sess *session, pdu smpp.Pdu) {
+	time.Sleep(s.config.Latency)
+
+	msgId := fmt.Sprintf("%X", atomic.AddUint64(&s.msgId, 1))
+	submittedAt := time.Now()
+
+	resp, _ := (&smpp.Smpp{}).SubmitSmResp(pdu.GetHeader().Sequence, smpp.CMDStatus(s.config.SubmitStatus), msgId)
+	sess.write(resp)
+
+	if s.config.SubmitStatus != uint32(smpp.ESME_ROK) || s.config.ReceiptStat == "" {
+		return
+	}
+	if registeredDelivery := pdu.GetField(smpp.REGISTERED_DELIVERY); registeredDelivery == nil || registeredDelivery.Value().(uint8)&0x01 == 0 {
+		return
+	}
+
+	time.Sleep(s.config.ReceiptDelay)
+
+	//receipts of transmitter sessions go to a receiver of the same system_id
+	receiver := s.receiverOf(sess)
+	if receiver == nil {
+		zap.L().Warn("No receiver bound for delivery receipt", zap.String("msg-id", msgId))
+		return
+	}
+
+	dlvrd := "000"
+	if s.config.ReceiptStat == "DELIVRD" {
+		dlvrd = "001"
+	}
+	text := pdu.GetField(smpp.SHORT_MESSAGE).String()
+	if len(text) > 20 {
+		text = text[:20]
+	}
+	receipt := fmt.Sprintf("id:%s sub:001 dlvrd:%s submit date:%s done date:%s stat:%s err:000 text:%s",
+		msgId, dlvrd, submittedAt.Format(receiptDateFormat), time.Now().Format(receiptDateFormat), s.config.ReceiptStat, text)
+
+	deliverSm, _ := smpp.NewDeliverSm(&smpp.Header{Id: smpp.DELIVER_SM, Sequence: receiver.nextSeq()}, []byte{})
+	_ = deliverSm.SetField(smpp.SOURCE_ADDR, pdu.GetField(smpp.DESTINATION_ADDR).String())
+	_ = deliverSm.SetField(smpp.DESTINATION_ADDR, pdu.GetField(smpp.SOURCE_ADDR).String())
+	_ = deliverSm.SetField(smpp.ESM_CLASS, 0x04)
+	_ = deliverSm.SetField(smpp.SHORT_MESSAGE, receipt)
+	receiver.write(deliverSm)
+}
+
+// receiverOf returns the session itself if it receives deliver_sm, otherwise a receiver session of the same system_id
+func (s *Simulator) receiverOf(sess *session) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess.receives {
+		return sess
+	}
+	for other := range s.sessions {
+		if other.bound && other.receives && other.systemId == sess.systemId {
+			return other
+		}
+	}
+	return nil
+}
+
+func (sess *session) nextSeq() uint32 {
+	return atomic.AddUint32(&sess.seq, 1)
+}
+
+func (sess *session) write(pdu smpp.Pdu) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	_, err := sess.conn.Write(pdu.Writer())
+	if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+		zap.L().Warn("Error writing PDU", zap.Error(err))
+	}
+}
+
+func (sess *session) writeGenericNack(seq uint32, status smpp.CMDStatus) {
+	nack, _ := (&smpp.Smpp{}).GenericNack(seq, status)
+	sess.write(nack)
+}
@@ -0,0 +1,268 @@
+package smscsim
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	smpp "github.com/Dilshat/smpp34"
+	"github.com/dilshat/sms-sender/model"
+	"github.com/dilshat/sms-sender/sms"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	SYSTEM_ID = "test"
+	PASSWORD  = "secret"
+	SENDER    = "sender"
+	PHONE     = "996YYYAABBCC"
+)
+
+func startSimulator(t *testing.T, config Config) (*Simulator, string, int) {
+	sim := New(config)
+	err := sim.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+
+	host, port, _ := net.SplitHostPort(sim.Addr().String())
+	portNo, _ := strconv.Atoi(port)
+
+	return sim, host, portNo
+}
+
+// clientConfig returns settings of a client of the simulator
+func clientConfig(host string, port int) sms.ClientConfig {
+	return sms.ClientConfig{Host: host, Port: port, SystemId: SYSTEM_ID, Password: PASSWORD, EnquireLinkSec: 30, Tps: 100,
+		Window: 10, SubmitTimeoutSec: 60, ConcatMode: sms.CONCAT_UDH8}
+}
+
+func TestSimulator_SubmitAndReceipt(t *testing.T) {
+	sim, host, port := startSimulator(t, Config{SystemId: SYSTEM_ID, Password: PASSWORD, ReceiptStat: "DELIVRD"})
+	defer sim.Close()
+
+	client := sms.NewClient(clientConfig(host, port))
+	submitted := make(chan string, 1)
+	delivered := make(chan string, 1)
+	client.BindSubmitSmResponseHandler(func(result sms.SubmitResult) {
+		submitted <- result.SmscId
+	})
+	client.BindDeliverSmHandler(func(receipt sms.Receipt) {
+		delivered <- receipt.SmscId + " " + receipt.Status
+	})
+
+	err := client.Connect()
+	require.NoError(t, err)
+	defer client.Disconnect()
+	go func() {
+		for client.IsConnected() {
+			_ = client.ReadPacket()
+		}
+	}()
+
+	err = client.SendMessage(1, SENDER, PHONE, "Hello", model.SubmitOptions{})
+	require.NoError(t, err)
+
+	var smscId string
+	select {
+	case smscId = <-submitted:
+	case <-time.After(time.Second * 5):
+		t.Fatal("submit_sm_resp not received")
+	}
+	require.NotEmpty(t, smscId)
+
+	select {
+	case receipt := <-delivered:
+		require.Equal(t, smscId+" DELIVRD", receipt)
+	case <-time.After(time.Second * 5):
+		t.Fatal("delivery receipt not received")
+	}
+}
+
+func TestSimulator_SubmitStatus(t *testing.T) {
+	sim, host, port := startSimulator(t, Config{SubmitStatus: uint32(smpp.ESME_RTHROTTLED), Latency: time.Millisecond * 50})
+	defer sim.Close()
+
+	client := sms.NewClient(clientConfig(host, port))
+	statuses := make(chan uint32, 1)
+	client.BindSubmitSmResponseHandler(func(result sms.SubmitResult) {
+		statuses <- result.Status
+	})
+
+	err := client.Connect()
+	require.NoError(t, err)
+	defer client.Disconnect()
+	go func() {
+		for client.IsConnected() {
+			_ = client.ReadPacket()
+		}
+	}()
+
+	err = client.SendMessage(1, SENDER, PHONE, "Hello", model.SubmitOptions{})
+	require.NoError(t, err)
+
+	select {
+	case status := <-statuses:
+		require.Equal(t, uint32(smpp.ESME_RTHROTTLED), status)
+	case <-time.After(time.Second * 5):
+		t.Fatal("submit_sm_resp not received")
+	}
+}
+
+func TestSimulator_TransmitterReceiver(t *testing.T) {
+	sim, host, port := startSimulator(t, Config{SystemId: SYSTEM_ID, Password: PASSWORD, ReceiptStat: "DELIVRD"})
+	defer sim.Close()
+
+	//submits go via transmitter bind, receipts come via receiver bind
+	config := clientConfig(host, port)
+	config.Bind = sms.BindConfig{Mode: sms.BIND_MODE_TXRX, SystemType: "test"}
+	client := sms.NewClient(config)
+	submitted := make(chan string, 1)
+	delivered := make(chan string, 1)
+	client.BindSubmitSmResponseHandler(func(result sms.SubmitResult) {
+		submitted <- result.SmscId
+	})
+	client.BindDeliverSmHandler(func(receipt sms.Receipt) {
+		delivered <- receipt.SmscId
+	})
+
+	err := client.Connect()
+	require.NoError(t, err)
+	defer client.Disconnect()
+	go func() {
+		for client.IsConnected() {
+			_ = client.ReadPacket()
+		}
+	}()
+
+	err = client.SendMessage(1, SENDER, PHONE, "Hello", model.SubmitOptions{})
+	require.NoError(t, err)
+
+	var smscId string
+	select {
+	case smscId = <-submitted:
+	case <-time.After(time.Second * 5):
+		t.Fatal("submit_sm_resp not received")
+	}
+
+	select {
+	case id := <-delivered:
+		require.Equal(t, smscId, id)
+	case <-time.After(time.Second * 5):
+		t.Fatal("delivery receipt not received")
+	}
+}
+
+func TestSimulator_MultipartSegments(t *testing.T) {
+	sim, host, port := startSimulator(t, Config{ReceiptStat: "DELIVRD"})
+	defer sim.Close()
+
+	config := clientConfig(host, port)
+	config.ConcatMode = sms.CONCAT_SAR
+	client := sms.NewClient(config)
+	//parts are linked with sar_* TLVs
+	submitted := make(chan sms.SubmitResult, 3)
+	delivered := make(chan string, 3)
+	client.BindSubmitSmResponseHandler(func(result sms.SubmitResult) {
+		submitted <- result
+	})
+	client.BindDeliverSmHandler(func(receipt sms.Receipt) {
+		delivered <- receipt.SmscId
+	})
+
+	err := client.Connect()
+	require.NoError(t, err)
+	defer client.Disconnect()
+	go func() {
+		for client.IsConnected() {
+			_ = client.ReadPacket()
+		}
+	}()
+
+	err = client.SendMessage(1, SENDER, PHONE, strings.Repeat("a", 400), model.SubmitOptions{})
+	require.NoError(t, err)
+
+	//every part is reported with its own SMSC id and receipt
+	smscIds := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		select {
+		case result := <-submitted:
+			require.Equal(t, uint32(1), result.Id)
+			require.Equal(t, 3, result.PartsCount)
+			smscIds[result.SmscId] = result.PartNo
+		case <-time.After(time.Second * 5):
+			t.Fatal("submit_sm_resp not received")
+		}
+	}
+	require.Equal(t, 3, len(smscIds))
+
+	for i := 0; i < 3; i++ {
+		select {
+		case smscId := <-delivered:
+			require.Contains(t, smscIds, smscId)
+		case <-time.After(time.Second * 5):
+			t.Fatal("delivery receipt not received")
+		}
+	}
+}
+
+func TestSimulator_MessagePayload(t *testing.T) {
+	sim, host, port := startSimulator(t, Config{ReceiptStat: "DELIVRD"})
+	defer sim.Close()
+
+	config := clientConfig(host, port)
+	config.ConcatMode = sms.CONCAT_PAYLOAD
+	client := sms.NewClient(config)
+	submitted := make(chan sms.SubmitResult, 3)
+	delivered := make(chan string, 3)
+	client.BindSubmitSmResponseHandler(func(result sms.SubmitResult) {
+		submitted <- result
+	})
+	client.BindDeliverSmHandler(func(receipt sms.Receipt) {
+		delivered <- receipt.SmscId
+	})
+
+	err := client.Connect()
+	require.NoError(t, err)
+	defer client.Disconnect()
+	go func() {
+		for client.IsConnected() {
+			_ = client.ReadPacket()
+		}
+	}()
+
+	err = client.SendMessage(1, SENDER, PHONE, strings.Repeat("a", 400), model.SubmitOptions{})
+	require.NoError(t, err)
+
+	//long message is submitted once and gets a single SMSC id and receipt
+	var smscId string
+	select {
+	case result := <-submitted:
+		require.Equal(t, 1, result.PartsCount)
+		smscId = result.SmscId
+	case <-time.After(time.Second * 5):
+		t.Fatal("submit_sm_resp not received")
+	}
+
+	select {
+	case id := <-delivered:
+		require.Equal(t, smscId, id)
+	case <-time.After(time.Second * 5):
+		t.Fatal("delivery receipt not received")
+	}
+	require.Empty(t, submitted)
+}
+
+func TestSimulator_BindFailure(t *testing.T) {
+	sim, host, port := startSimulator(t, Config{SystemId: SYSTEM_ID, Password: PASSWORD})
+	defer sim.Close()
+
+	config := clientConfig(host, port)
+	config.Password = "wrong"
+	client := sms.NewClient(config)
+
+	err := client.Connect()
+
+	require.Error(t, err)
+	require.False(t, client.IsConnected())
+}
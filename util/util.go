@@ -37,6 +37,32 @@ func GetEnvAsInt(name string, defaultVal int) int {
 	return defaultVal
 }
 
+// GetEnvAsOptionalInt returns defaultVal if the variable is not set or is not a number
+func GetEnvAsOptionalInt(name string, defaultVal *int) *int {
+	valueStr := GetEnv(name, "")
+	if value, err := strconv.Atoi(valueStr); err == nil {
+		return &value
+	}
+
+	return defaultVal
+}
+
+func GetEnvAsList(name string, defaultVal []string) []string {
+	valueStr := GetEnv(name, "")
+	if IsBlank(valueStr) {
+		return defaultVal
+	}
+
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if !IsBlank(value) {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+
+	return values
+}
+
 func IsASCII(s string) bool {
 	for i := 0; i < len(s); i++ {
 		if s[i] > unicode.MaxASCII {
@@ -23,6 +23,24 @@ func TestGetEnvAsInt(t *testing.T) {
 	}
 }
 
+func TestGetEnvAsOptionalInt(t *testing.T) {
+	_ = os.Setenv("TEST_VAR", "0")
+	actual := GetEnvAsOptionalInt("TEST_VAR", nil)
+	require.NotNil(t, actual)
+	require.Equal(t, 0, *actual)
+
+	_ = os.Setenv("TEST_VAR", "")
+	require.Nil(t, GetEnvAsOptionalInt("TEST_VAR", nil))
+}
+
+func TestGetEnvAsList(t *testing.T) {
+	_ = os.Setenv("TEST_VAR", " one, two ,,three")
+	require.Equal(t, []string{"one", "two", "three"}, GetEnvAsList("TEST_VAR", nil))
+
+	_ = os.Setenv("TEST_VAR", " ")
+	require.Equal(t, []string{"default"}, GetEnvAsList("TEST_VAR", []string{"default"}))
+}
+
 func TestIsASCII(t *testing.T) {
 	require.True(t, IsASCII("Hello"))
 	require.False(t, IsASCII("Привет"))